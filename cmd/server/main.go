@@ -2,13 +2,15 @@ package main
 
 import (
 	"log"
+	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
 	"ambridge-backend/config"
 	"ambridge-backend/database"
+	"ambridge-backend/middleware"
 	"ambridge-backend/routes"
+	"ambridge-backend/utils"
 )
 
 func main() {
@@ -21,20 +23,33 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Load the JWT signing keys and pick up rotated keys in the background
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	utils.StartKeyReloader(time.Minute)
+
+	// Remove expired token revocations in the background
+	utils.StartRevocationPruner(time.Hour)
+
+	// Purge accounts whose deletion grace period has passed
+	utils.StartAccountSweeper(time.Hour)
+
 	// Set up Gin router
 	router := gin.Default()
 
-	// Configure CORS
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-	}))
+	// Only trusted proxies may set the client IP used for lockouts and audit events
+	if err := router.SetTrustedProxies(config.GetTrustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Only the origins in CORS_ALLOWED_ORIGINS may send credentials
+	router.Use(middleware.CORSMiddleware())
 
 	// Set up routes
 	routes.SetupAuthRoutes(router)
+	routes.SetupWellKnownRoutes(router)
+	routes.SetupAdminRoutes(router)
 
 	// Get port from environment variable or use default
 	port := config.GetServerPort()
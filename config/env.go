@@ -4,10 +4,39 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
+// OIDCProviderConfig configures one social login provider. Providers of type
+// 'oidc' are discovered from their issuer; 'github' speaks plain OAuth 2.0 and
+// only needs the endpoint URLs when they differ from github.com.
+type OIDCProviderConfig struct {
+	Name         string
+	Type         string // 'oidc' or 'github'
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	AuthURL      string
+	TokenURL     string
+	APIURL       string
+}
+
+// Registration modes of REGISTRATION_MODE
+const (
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "invite-only"
+	RegistrationClosed     = "closed"
+)
+
+// Password hash algorithms of PASSWORD_HASH_ALGORITHM
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
 type Config struct {
 	// MySQL Config
 	MySQLHost     string
@@ -20,8 +49,111 @@ type Config struct {
 	JWTSecret     string
 	JWTExpiration int // in hours
 
+	// JWT Signing Config
+	JWTAlgorithm      string // 'HS256', 'RS256' or 'EdDSA'
+	JWTKeysDir        string
+	JWTActiveKeyID    string
+	JWTKeyGracePeriod int // in hours
+	JWTIssuer         string
+	JWTAudience       string
+
+	// Session Config
+	RefreshTokenExpiration int // in days, how long an unused refresh token stays valid
+	SessionLifetime        int // in days, absolute lifetime of a session regardless of refreshes
+
+	// Token Revocation Config
+	RevocationCacheTTL int // in seconds
+
+	// Permission Config
+	PermissionCacheTTL int // in seconds
+
+	// API Key Config
+	APIKeyMaxPerUser  int
+	APIKeyMaxLifetime int // in days, 0 allows keys that never expire
+
 	// Server Config
-	ServerPort string
+	ServerPort     string
+	TrustedProxies []string // proxies whose X-Forwarded-For is used for the client IP
+
+	// Browser Config
+	CORSAllowedOrigins []string // '*' allows every origin, without credentials
+	AuthCookieMode     bool     // set tokens as HttpOnly cookies for browser requests
+	AuthCookieDomain   string
+	AuthCookieSecure   bool
+	AuthCookieSameSite string // 'lax', 'strict' or 'none'
+
+	// OTP Config
+	OTPExpiration     int // in minutes
+	OTPMaxAttempts    int
+	OTPResendInterval int // in seconds
+
+	// Password Reset Config
+	PasswordResetRateLimit int // requests per email per hour
+
+	// Magic Link Config
+	MagicLinkURL        string // frontend page that consumes the link, the token is appended as ?token=
+	MagicLinkExpiration int    // in minutes
+	MagicLinkRateLimit  int    // requests per email per hour
+
+	// Account Deletion Config
+	AccountDeletionGracePeriod int // in days
+
+	// Registration Config
+	RegistrationMode     string // 'open', 'invite-only' or 'closed'
+	InvitationURL        string // frontend signup page, the invite code is appended as ?invite=
+	InvitationExpiration int    // in days, default lifetime of new invitations
+
+	// Impersonation Config
+	ImpersonationExpiration int // in minutes
+
+	// Passkey Config
+	WebAuthnRPID                string   // domain the passkeys are bound to
+	WebAuthnRPName              string   // name shown by the authenticator
+	WebAuthnOrigins             []string // frontend origins allowed to run the ceremonies
+	WebAuthnChallengeExpiration int      // in minutes
+
+	// Password Policy Config
+	PasswordMinLength            int
+	PasswordMaxLength            int // in bytes, bcrypt ignores everything after 72 bytes
+	PasswordRequireUpper         bool
+	PasswordRequireLower         bool
+	PasswordRequireDigit         bool
+	PasswordRequireSymbol        bool
+	PasswordDisallowPersonalInfo bool
+	PasswordBreachedListFile     string // sorted file of SHA-1 hashes of breached passwords, empty to disable
+
+	// Password Hashing Config
+	PasswordHashAlgorithm     string // 'argon2id' or 'bcrypt', used for new hashes
+	PasswordBcryptCost        int
+	PasswordArgon2Memory      int // in KiB
+	PasswordArgon2Iterations  int
+	PasswordArgon2Parallelism int
+
+	// Login Protection Config
+	LoginAttemptStore     string // 'memory' or 'database'
+	LoginMaxFailures      int
+	LoginMaxFailuresPerIP int
+	LoginLockoutDuration  int // in minutes
+	LoginBackoffBase      int // in seconds
+
+	// Two-Factor Authentication Config
+	MFAIssuer           string
+	MFATokenExpiration  int // in minutes
+	MFARequiredForAdmin bool
+
+	// Social Login Config
+	OIDCProviders       []OIDCProviderConfig
+	OIDCRedirectURL     string // frontend callback, the provider name is appended
+	OIDCStateExpiration int    // in minutes
+
+	// Mail Config
+	MailTransport string // 'log', 'file' or 'smtp'
+	MailFrom      string
+	MailOutputDir string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUser      string
+	SMTPPassword  string
 }
 
 var AppConfig *Config
@@ -44,8 +176,111 @@ func LoadConfig() {
 		JWTSecret:     getEnv("JWT_SECRET", "ambridge_secret_key_change_this_in_production"),
 		JWTExpiration: getEnvAsInt("JWT_EXPIRATION", 24), // default 24 hours
 
+		// JWT Signing Config
+		JWTAlgorithm:      getEnv("JWT_ALGORITHM", "HS256"),
+		JWTKeysDir:        getEnv("JWT_KEYS_DIR", "keys"),
+		JWTActiveKeyID:    getEnv("JWT_ACTIVE_KEY_ID", ""),
+		JWTKeyGracePeriod: getEnvAsInt("JWT_KEY_GRACE_PERIOD", 48), // default 48 hours
+		JWTIssuer:         getEnv("JWT_ISSUER", "ambridge-backend"),
+		JWTAudience:       getEnv("JWT_AUDIENCE", "ambridge-api"),
+
+		// Session Config
+		RefreshTokenExpiration: getEnvAsInt("REFRESH_TOKEN_EXPIRATION", 30), // default 30 days
+		SessionLifetime:        getEnvAsInt("SESSION_LIFETIME", 90),         // default 90 days
+
+		// Token Revocation Config
+		RevocationCacheTTL: getEnvAsInt("REVOCATION_CACHE_TTL", 30), // default 30 seconds
+
+		// Permission Config
+		PermissionCacheTTL: getEnvAsInt("PERMISSION_CACHE_TTL", 60), // default 60 seconds
+
+		// API Key Config
+		APIKeyMaxPerUser:  getEnvAsInt("API_KEY_MAX_PER_USER", 10),
+		APIKeyMaxLifetime: getEnvAsInt("API_KEY_MAX_LIFETIME", 365), // default 365 days
+
 		// Server Config
-		ServerPort: getEnv("SERVER_PORT", "8080"),
+		ServerPort:     getEnv("SERVER_PORT", "8080"),
+		TrustedProxies: getEnvAsList("TRUSTED_PROXIES", ""), // default none, the peer address is the client IP
+
+		// Browser Config
+		CORSAllowedOrigins: getEnvAsList("CORS_ALLOWED_ORIGINS", "http://localhost:3000"),
+		AuthCookieMode:     getEnvAsBool("AUTH_COOKIE_MODE", false),
+		AuthCookieDomain:   getEnv("AUTH_COOKIE_DOMAIN", ""),
+		AuthCookieSecure:   getEnvAsBool("AUTH_COOKIE_SECURE", true),
+		AuthCookieSameSite: getEnv("AUTH_COOKIE_SAMESITE", "lax"),
+
+		// OTP Config
+		OTPExpiration:     getEnvAsInt("OTP_EXPIRATION", 15), // default 15 minutes
+		OTPMaxAttempts:    getEnvAsInt("OTP_MAX_ATTEMPTS", 5),
+		OTPResendInterval: getEnvAsInt("OTP_RESEND_INTERVAL", 60), // default 60 seconds
+
+		// Password Reset Config
+		PasswordResetRateLimit: getEnvAsInt("PASSWORD_RESET_RATE_LIMIT", 3),
+
+		// Magic Link Config
+		MagicLinkURL:        getEnv("MAGIC_LINK_URL", "http://localhost:3000/auth/magic-link"),
+		MagicLinkExpiration: getEnvAsInt("MAGIC_LINK_EXPIRATION", 15), // default 15 minutes
+		MagicLinkRateLimit:  getEnvAsInt("MAGIC_LINK_RATE_LIMIT", 3),
+
+		// Account Deletion Config
+		AccountDeletionGracePeriod: getEnvAsInt("ACCOUNT_DELETION_GRACE_PERIOD", 30), // default 30 days
+
+		// Registration Config
+		RegistrationMode:     getRegistrationMode(),
+		InvitationURL:        getEnv("INVITATION_URL", "http://localhost:3000/register"),
+		InvitationExpiration: getEnvAsInt("INVITATION_EXPIRATION", 7), // default 7 days
+
+		// Impersonation Config
+		ImpersonationExpiration: getEnvAsInt("IMPERSONATION_EXPIRATION", 15), // default 15 minutes
+
+		// Passkey Config
+		WebAuthnRPID:                getEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:              getEnv("WEBAUTHN_RP_NAME", "Ambridge"),
+		WebAuthnOrigins:             getEnvAsList("WEBAUTHN_ORIGINS", "http://localhost:3000"),
+		WebAuthnChallengeExpiration: getEnvAsInt("WEBAUTHN_CHALLENGE_EXPIRATION", 5), // default 5 minutes
+
+		// Password Policy Config
+		PasswordMinLength:            getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:            getEnvAsInt("PASSWORD_MAX_LENGTH", 72),
+		PasswordRequireUpper:         getEnvAsBool("PASSWORD_REQUIRE_UPPER", true),
+		PasswordRequireLower:         getEnvAsBool("PASSWORD_REQUIRE_LOWER", true),
+		PasswordRequireDigit:         getEnvAsBool("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol:        getEnvAsBool("PASSWORD_REQUIRE_SYMBOL", false),
+		PasswordDisallowPersonalInfo: getEnvAsBool("PASSWORD_DISALLOW_PERSONAL_INFO", true),
+		PasswordBreachedListFile:     getEnv("PASSWORD_BREACHED_LIST_FILE", ""),
+
+		// Password Hashing Config
+		PasswordHashAlgorithm:     getPasswordHashAlgorithm(),
+		PasswordBcryptCost:        getEnvAsInt("PASSWORD_BCRYPT_COST", 12),
+		PasswordArgon2Memory:      getEnvAsInt("PASSWORD_ARGON2_MEMORY", 64*1024), // default 64 MiB
+		PasswordArgon2Iterations:  getEnvAsInt("PASSWORD_ARGON2_ITERATIONS", 3),
+		PasswordArgon2Parallelism: getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", 2),
+
+		// Login Protection Config
+		LoginAttemptStore:     getEnv("LOGIN_ATTEMPT_STORE", "memory"),
+		LoginMaxFailures:      getEnvAsInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxFailuresPerIP: getEnvAsInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+		LoginLockoutDuration:  getEnvAsInt("LOGIN_LOCKOUT_DURATION", 15), // default 15 minutes
+		LoginBackoffBase:      getEnvAsInt("LOGIN_BACKOFF_BASE", 1),      // default 1 second
+
+		// Two-Factor Authentication Config
+		MFAIssuer:           getEnv("MFA_ISSUER", "Ambridge"),
+		MFATokenExpiration:  getEnvAsInt("MFA_TOKEN_EXPIRATION", 5), // default 5 minutes
+		MFARequiredForAdmin: getEnvAsBool("MFA_REQUIRED_FOR_ADMIN", false),
+
+		// Social Login Config
+		OIDCProviders:       getOIDCProviders(),
+		OIDCRedirectURL:     getEnv("OIDC_REDIRECT_URL", "http://localhost:3000/auth/callback"),
+		OIDCStateExpiration: getEnvAsInt("OIDC_STATE_EXPIRATION", 10), // default 10 minutes
+
+		// Mail Config
+		MailTransport: getEnv("MAIL_TRANSPORT", "log"),
+		MailFrom:      getEnv("MAIL_FROM", "no-reply@ambridge.local"),
+		MailOutputDir: getEnv("MAIL_OUTPUT_DIR", "mail_output"),
+		SMTPHost:      getEnv("SMTP_HOST", ""),
+		SMTPPort:      getEnv("SMTP_PORT", "587"),
+		SMTPUser:      getEnv("SMTP_USER", ""),
+		SMTPPassword:  getEnv("SMTP_PASSWORD", ""),
 	}
 }
 
@@ -65,6 +300,81 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsList(key, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getOIDCProviders reads the providers listed in OIDC_PROVIDERS. Each provider
+// is configured with OIDC_<NAME>_* variables, e.g. OIDC_GOOGLE_CLIENT_ID.
+func getOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providerType := getEnv(prefix+"TYPE", "oidc")
+		defaultScopes := "openid email profile"
+		if providerType == "github" {
+			defaultScopes = "read:user user:email"
+		}
+
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			Type:         providerType,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", defaultScopes)),
+			AuthURL:      getEnv(prefix+"AUTH_URL", ""),
+			TokenURL:     getEnv(prefix+"TOKEN_URL", ""),
+			APIURL:       getEnv(prefix+"API_URL", ""),
+		})
+	}
+	return providers
+}
+
+// getRegistrationMode reads REGISTRATION_MODE. Unknown values close
+// registration rather than silently leaving it open.
+func getRegistrationMode() string {
+	mode := strings.ToLower(strings.TrimSpace(getEnv("REGISTRATION_MODE", RegistrationOpen)))
+	switch mode {
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationClosed:
+		return mode
+	}
+	log.Printf("Unknown REGISTRATION_MODE %q, registration is closed", mode)
+	return RegistrationClosed
+}
+
+// getPasswordHashAlgorithm reads PASSWORD_HASH_ALGORITHM. An unknown value
+// stops the server rather than silently hashing new passwords with the default.
+func getPasswordHashAlgorithm() string {
+	algorithm := strings.ToLower(strings.TrimSpace(getEnv("PASSWORD_HASH_ALGORITHM", PasswordHashArgon2id)))
+	switch algorithm {
+	case PasswordHashArgon2id, PasswordHashBcrypt:
+		return algorithm
+	}
+	log.Fatalf("Unknown PASSWORD_HASH_ALGORITHM %q, expected %s or %s", algorithm, PasswordHashArgon2id, PasswordHashBcrypt)
+	return ""
+}
+
 // Database access functions
 func GetMySQLDSN() string {
 	return AppConfig.MySQLUser + ":" + AppConfig.MySQLPassword + "@tcp(" +
@@ -101,7 +411,285 @@ func GetJWTExpiration() int {
 	return AppConfig.JWTExpiration
 }
 
+func GetJWTAlgorithm() string {
+	return AppConfig.JWTAlgorithm
+}
+
+func GetJWTKeysDir() string {
+	return AppConfig.JWTKeysDir
+}
+
+func GetJWTActiveKeyID() string {
+	return AppConfig.JWTActiveKeyID
+}
+
+func GetJWTKeyGracePeriod() int {
+	return AppConfig.JWTKeyGracePeriod
+}
+
+func GetJWTIssuer() string {
+	return AppConfig.JWTIssuer
+}
+
+func GetJWTAudience() string {
+	return AppConfig.JWTAudience
+}
+
+// Session access functions
+func GetRefreshTokenExpiration() int {
+	return AppConfig.RefreshTokenExpiration
+}
+
+func GetSessionLifetime() int {
+	return AppConfig.SessionLifetime
+}
+
+// Token revocation access functions
+func GetRevocationCacheTTL() int {
+	return AppConfig.RevocationCacheTTL
+}
+
+// Permission access functions
+func GetPermissionCacheTTL() int {
+	return AppConfig.PermissionCacheTTL
+}
+
+// API key access functions
+func GetAPIKeyMaxPerUser() int {
+	return AppConfig.APIKeyMaxPerUser
+}
+
+func GetAPIKeyMaxLifetime() int {
+	return AppConfig.APIKeyMaxLifetime
+}
+
 // Server access functions
 func GetServerPort() string {
 	return AppConfig.ServerPort
 }
+
+func GetTrustedProxies() []string {
+	return AppConfig.TrustedProxies
+}
+
+// Browser access functions
+func GetCORSAllowedOrigins() []string {
+	return AppConfig.CORSAllowedOrigins
+}
+
+func GetAuthCookieMode() bool {
+	return AppConfig.AuthCookieMode
+}
+
+func GetAuthCookieDomain() string {
+	return AppConfig.AuthCookieDomain
+}
+
+func GetAuthCookieSecure() bool {
+	return AppConfig.AuthCookieSecure
+}
+
+func GetAuthCookieSameSite() string {
+	return AppConfig.AuthCookieSameSite
+}
+
+// OTP access functions
+func GetOTPExpiration() int {
+	return AppConfig.OTPExpiration
+}
+
+func GetOTPMaxAttempts() int {
+	return AppConfig.OTPMaxAttempts
+}
+
+func GetOTPResendInterval() int {
+	return AppConfig.OTPResendInterval
+}
+
+// Password reset access functions
+func GetPasswordResetRateLimit() int {
+	return AppConfig.PasswordResetRateLimit
+}
+
+// Magic link access functions
+func GetMagicLinkURL() string {
+	return AppConfig.MagicLinkURL
+}
+
+func GetMagicLinkExpiration() int {
+	return AppConfig.MagicLinkExpiration
+}
+
+func GetMagicLinkRateLimit() int {
+	return AppConfig.MagicLinkRateLimit
+}
+
+// Account deletion access functions
+func GetAccountDeletionGracePeriod() int {
+	return AppConfig.AccountDeletionGracePeriod
+}
+
+// Registration access functions
+func GetRegistrationMode() string {
+	return AppConfig.RegistrationMode
+}
+
+func GetInvitationURL() string {
+	return AppConfig.InvitationURL
+}
+
+func GetInvitationExpiration() int {
+	return AppConfig.InvitationExpiration
+}
+
+// Impersonation access functions
+func GetImpersonationExpiration() int {
+	return AppConfig.ImpersonationExpiration
+}
+
+// Passkey access functions
+func GetWebAuthnRPID() string {
+	return AppConfig.WebAuthnRPID
+}
+
+func GetWebAuthnRPName() string {
+	return AppConfig.WebAuthnRPName
+}
+
+func GetWebAuthnOrigins() []string {
+	return AppConfig.WebAuthnOrigins
+}
+
+func GetWebAuthnChallengeExpiration() int {
+	return AppConfig.WebAuthnChallengeExpiration
+}
+
+// Password policy access functions
+func GetPasswordMinLength() int {
+	return AppConfig.PasswordMinLength
+}
+
+func GetPasswordMaxLength() int {
+	return AppConfig.PasswordMaxLength
+}
+
+func GetPasswordRequireUpper() bool {
+	return AppConfig.PasswordRequireUpper
+}
+
+func GetPasswordRequireLower() bool {
+	return AppConfig.PasswordRequireLower
+}
+
+func GetPasswordRequireDigit() bool {
+	return AppConfig.PasswordRequireDigit
+}
+
+func GetPasswordRequireSymbol() bool {
+	return AppConfig.PasswordRequireSymbol
+}
+
+func GetPasswordDisallowPersonalInfo() bool {
+	return AppConfig.PasswordDisallowPersonalInfo
+}
+
+func GetPasswordBreachedListFile() string {
+	return AppConfig.PasswordBreachedListFile
+}
+
+// Password hashing access functions
+func GetPasswordHashAlgorithm() string {
+	return AppConfig.PasswordHashAlgorithm
+}
+
+func GetPasswordBcryptCost() int {
+	return AppConfig.PasswordBcryptCost
+}
+
+func GetPasswordArgon2Memory() int {
+	return AppConfig.PasswordArgon2Memory
+}
+
+func GetPasswordArgon2Iterations() int {
+	return AppConfig.PasswordArgon2Iterations
+}
+
+func GetPasswordArgon2Parallelism() int {
+	return AppConfig.PasswordArgon2Parallelism
+}
+
+// Login protection access functions
+func GetLoginAttemptStore() string {
+	return AppConfig.LoginAttemptStore
+}
+
+func GetLoginMaxFailures() int {
+	return AppConfig.LoginMaxFailures
+}
+
+func GetLoginMaxFailuresPerIP() int {
+	return AppConfig.LoginMaxFailuresPerIP
+}
+
+func GetLoginLockoutDuration() int {
+	return AppConfig.LoginLockoutDuration
+}
+
+func GetLoginBackoffBase() int {
+	return AppConfig.LoginBackoffBase
+}
+
+// Two-factor authentication access functions
+func GetMFAIssuer() string {
+	return AppConfig.MFAIssuer
+}
+
+func GetMFATokenExpiration() int {
+	return AppConfig.MFATokenExpiration
+}
+
+func GetMFARequiredForAdmin() bool {
+	return AppConfig.MFARequiredForAdmin
+}
+
+// Social login access functions
+func GetOIDCProviders() []OIDCProviderConfig {
+	return AppConfig.OIDCProviders
+}
+
+func GetOIDCRedirectURL() string {
+	return AppConfig.OIDCRedirectURL
+}
+
+func GetOIDCStateExpiration() int {
+	return AppConfig.OIDCStateExpiration
+}
+
+// Mail access functions
+func GetMailTransport() string {
+	return AppConfig.MailTransport
+}
+
+func GetMailFrom() string {
+	return AppConfig.MailFrom
+}
+
+func GetMailOutputDir() string {
+	return AppConfig.MailOutputDir
+}
+
+func GetSMTPHost() string {
+	return AppConfig.SMTPHost
+}
+
+func GetSMTPPort() string {
+	return AppConfig.SMTPPort
+}
+
+func GetSMTPUser() string {
+	return AppConfig.SMTPUser
+}
+
+func GetSMTPPassword() string {
+	return AppConfig.SMTPPassword
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/mailer"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// ChangePasswordRequest represents the request body for changing the password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangeEmailRequest represents the request body for starting an email change
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ConfirmEmailChangeRequest represents the request body for confirming an email change
+type ConfirmEmailChangeRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// checkCurrentPassword re-authenticates the user before a sensitive account change
+func checkCurrentPassword(c *gin.Context, user *models.User, password string) bool {
+	if !secondFactorLimiter().Allow(user.Email) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, please try again later", "code": "too_many_attempts"})
+		return false
+	}
+
+	if !utils.CheckPassword(user.Password, password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password", "code": "invalid_password"})
+		return false
+	}
+
+	return true
+}
+
+// ChangePassword sets a new password for the current user and signs out their other sessions
+func ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !checkCurrentPassword(c, user, req.CurrentPassword) {
+		return
+	}
+	if !checkPasswordPolicy(c, req.NewPassword, user.Email, user.Name, user.Surname) {
+		return
+	}
+
+	// Hash password
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	if err := database.DB.Model(user).Update("password", hashedPassword).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// Everyone who knew the old password is signed out, except this device
+	if err := revokeUserSessions(user.ID, currentSessionID(c)); err != nil {
+		log.Printf("Failed to revoke sessions of user %d after password change: %v", user.ID, err)
+	}
+
+	err = mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Ambridge password was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nThe password of your Ambridge account was just changed and your other devices were signed out. "+
+			"If you did not do this, reset your password immediately.", user.Name),
+	})
+	if err != nil {
+		log.Printf("Failed to send password change notice to user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// ChangeEmail starts an email change by sending a confirmation code to the new
+// address. The login email stays the same until the code is confirmed.
+func ChangeEmail(c *gin.Context) {
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	newEmail := strings.ToLower(req.NewEmail)
+	if newEmail == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New email is the same as the current one"})
+		return
+	}
+
+	if !checkCurrentPassword(c, user, req.Password) {
+		return
+	}
+
+	// The unique index also covers soft-deleted users
+	var count int64
+	if err := database.DB.Unscoped().Model(&models.User{}).Where("email = ?", newEmail).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	code, err := issueVerificationCode(user.ID, models.VerificationPurposeEmailChange)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	if err := database.DB.Model(user).Update("pending_email", newEmail).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start email change"})
+		return
+	}
+
+	err = mailer.Send(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Ambridge email address",
+		Body: fmt.Sprintf("Hi %s,\n\nYour Ambridge email change code is: %s\n\nThe code expires in %d minutes.",
+			user.Name, code, config.GetOTPExpiration()),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send confirmation email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "A confirmation code was sent to the new email address",
+		"pending_email": newEmail,
+	})
+}
+
+// ConfirmEmailChange swaps the login email to the pending address once the code
+// sent to it is confirmed
+func ConfirmEmailChange(c *gin.Context) {
+	var req ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.PendingEmail == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No email change is pending"})
+		return
+	}
+
+	if err := consumeVerificationCode(user.ID, models.VerificationPurposeEmailChange, req.Code); err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	oldEmail, newEmail := user.Email, user.PendingEmail
+	err := database.DB.Model(user).Updates(map[string]interface{}{
+		"email":             newEmail,
+		"pending_email":     "",
+		"email_verified_at": time.Now(),
+	}).Error
+	if err != nil {
+		// Someone registered the address after the change was started
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		}
+		return
+	}
+
+	// Let the previous address know in case the account was taken over
+	err = mailer.Send(mailer.Message{
+		To:      oldEmail,
+		Subject: "Your Ambridge email address was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nThe email address of your Ambridge account was changed to %s. "+
+			"If you did not do this, please contact support immediately.", user.Name, newEmail),
+	})
+	if err != nil {
+		log.Printf("Failed to send email change notice to user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email changed successfully",
+		"email":   newEmail,
+	})
+}
@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/database"
+	"ambridge-backend/middleware"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// Pagination limits of the admin user list
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// likeEscaper escapes the LIKE wildcards in user supplied search terms
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// findUserByParam loads the user addressed by the :id route parameter and
+// writes the error response when it cannot be found
+func findUserByParam(c *gin.Context) (*models.User, bool) {
+	return findUserByParamIn(c, database.DB)
+}
+
+// findUserByParamIn is findUserByParam on a custom query, e.g. one that includes deleted users
+func findUserByParamIn(c *gin.Context, db *gorm.DB) (*models.User, bool) {
+	// Check if the ID is a valid number
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var user models.User
+	result := db.First(&user, userID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// adminUserView is the representation of a user in the admin API
+func adminUserView(user *models.User) gin.H {
+	view := gin.H{
+		"id":                user.ID,
+		"name":              user.Name,
+		"surname":           user.Surname,
+		"email":             user.Email,
+		"role":              user.Role,
+		"profileImage":      user.ProfileImage,
+		"company":           user.CompanyName,
+		"currentPosition":   user.Position,
+		"email_verified_at": user.EmailVerifiedAt,
+		"mfa_enabled":       user.IsTOTPEnabled(),
+		"status":            user.Status,
+		"created_at":        user.CreatedAt,
+		"updated_at":        user.UpdatedAt,
+	}
+	if user.DeletedAt.Valid {
+		view["deleted_at"] = user.DeletedAt.Time
+	}
+	return view
+}
+
+// auditAdminAction records an admin action on a user's account as an auth event
+func auditAdminAction(c *gin.Context, userID uint, eventType, details string) {
+	actorID, _ := actingUserID(c)
+	recordAuthEvent(c, userID, eventType, models.AuthOutcomeSuccess, fmt.Sprintf("%s by admin %d", details, actorID))
+}
+
+// actingUserID returns the ID of the person behind the request: the admin
+// while a user is impersonated, the logged in user otherwise
+func actingUserID(c *gin.Context) (uint, bool) {
+	if actorID, impersonated := middleware.Impersonator(c); impersonated {
+		return actorID, true
+	}
+	userID, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+	return userID.(uint), true
+}
+
+// rejectSelfAction stops admins from locking themselves out of their own account
+func rejectSelfAction(c *gin.Context, user *models.User) bool {
+	actorID, _ := c.Get("user_id")
+	if actorID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot perform this action on your own account"})
+		return true
+	}
+	return false
+}
+
+// signOutUser revokes every session and access token of a user
+func signOutUser(userID uint) error {
+	if err := revokeUserSessions(userID, 0); err != nil {
+		return err
+	}
+	return utils.RevokeUserTokens(userID)
+}
+
+// ListUsers returns a page of users, optionally filtered by a search term
+// matching name, surname, email or company, by role, or by account status
+func ListUsers(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultUserPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxUserPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("page_size must be between 1 and %d", maxUserPageSize)})
+		return
+	}
+
+	query := database.DB.Model(&models.User{})
+	if status := c.Query("status"); status != "" {
+		if !models.IsValidUserStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+		// Deleted users are hidden unless asked for
+		if status == models.UserStatusDeleted {
+			query = query.Unscoped()
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	if search := strings.TrimSpace(c.Query("q")); search != "" {
+		like := "%" + likeEscaper.Replace(search) + "%"
+		query = query.Where("name LIKE ? OR surname LIKE ? OR email LIKE ? OR company_name LIKE ?", like, like, like, like)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	var users []models.User
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(users))
+	for i := range users {
+		items = append(items, adminUserView(&users[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"users":  items,
+		"pagination": gin.H{
+			"page":      page,
+			"page_size": pageSize,
+			"total":     total,
+		},
+	})
+}
+
+// GetUser returns a single user, including deleted users
+func GetUser(c *gin.Context) {
+	user, ok := findUserByParamIn(c, database.DB.Unscoped())
+	if !ok {
+		return
+	}
+
+	var activeSessions int64
+	if err := database.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Count(&activeSessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	view := adminUserView(user)
+	view["active_sessions"] = activeSessions
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"user":   view,
+	})
+}
+
+// UnlockUser clears the failed login attempts of a user so they can log in
+// again before the lockout expires
+func UnlockUser(c *gin.Context) {
+	user, ok := findUserByParam(c)
+	if !ok {
+		return
+	}
+
+	emailKey := "email:" + user.Email
+	if err := utils.Attempts().Reset(emailKey); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	auditAdminAction(c, user.ID, models.AuthEventUserUnlocked, "Failed login attempts cleared")
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "User unlocked successfully",
+	})
+}
+
+// UserStatusRequest represents the request body for changing a user's account status
+type UserStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// setUserStatus changes the account status of the user addressed by :id and
+// writes the response. Deleted users are only found when restoring them.
+func setUserStatus(c *gin.Context, status string, eventType, message string) {
+	// The body is optional, it only carries the reason
+	var req UserStatusRequest
+	if err := c.ShouldBindBodyWithJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := database.DB
+	if status == models.UserStatusActive {
+		db = db.Unscoped()
+	}
+	user, ok := findUserByParamIn(c, db)
+	if !ok {
+		return
+	}
+	if status != models.UserStatusActive && rejectSelfAction(c, user) {
+		return
+	}
+
+	previous := user.Status
+	if err := changeUserStatus(c, user, status, req.Reason); err != nil {
+		if errors.Is(err, errInvalidStatusTransition) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Cannot change status from %s to %s", previous, status),
+				"code":  "invalid_status_transition",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change user status"})
+		}
+		return
+	}
+
+	details := fmt.Sprintf("Status changed from %s to %s", previous, status)
+	if req.Reason != "" {
+		details += ": " + req.Reason
+	}
+	auditAdminAction(c, user.ID, eventType, details)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": message,
+	})
+}
+
+// SuspendUser blocks a user from logging in and signs them out everywhere
+func SuspendUser(c *gin.Context) {
+	setUserStatus(c, models.UserStatusSuspended, models.AuthEventUserSuspended, "User suspended successfully")
+}
+
+// ReactivateUser lifts the suspension of a user
+func ReactivateUser(c *gin.Context) {
+	setUserStatus(c, models.UserStatusActive, models.AuthEventUserReactivated, "User reactivated successfully")
+}
+
+// ForceLogoutUser revokes every session and access token of a user
+func ForceLogoutUser(c *gin.Context) {
+	user, ok := findUserByParam(c)
+	if !ok {
+		return
+	}
+
+	if err := signOutUser(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	auditAdminAction(c, user.ID, models.AuthEventUserLoggedOut, "All sessions revoked")
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "User logged out from all sessions",
+	})
+}
+
+// DeleteUser soft-deletes a user and signs them out everywhere. The account
+// can be restored; its email address stays reserved until then.
+func DeleteUser(c *gin.Context) {
+	setUserStatus(c, models.UserStatusDeleted, models.AuthEventUserDeleted, "User deleted successfully")
+}
+
+// RestoreUser undoes the soft deletion of a user
+func RestoreUser(c *gin.Context) {
+	setUserStatus(c, models.UserStatusActive, models.AuthEventUserRestored, "User restored successfully")
+}
+
+// UpdateUserStatus moves a user to any status allowed by the status transitions
+func UpdateUserStatus(c *gin.Context) {
+	var req UserStatusRequest
+	if err := c.ShouldBindBodyWithJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsValidUserStatus(req.Status) || req.Status == models.UserStatusPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of active, suspended or deleted"})
+		return
+	}
+
+	eventTypes := map[string]string{
+		models.UserStatusActive:    models.AuthEventUserReactivated,
+		models.UserStatusSuspended: models.AuthEventUserSuspended,
+		models.UserStatusDeleted:   models.AuthEventUserDeleted,
+	}
+	setUserStatus(c, req.Status, eventTypes[req.Status], "User status changed successfully")
+}
+
+// GetUserStatusHistory returns the status changes of a user, newest first
+func GetUserStatusHistory(c *gin.Context) {
+	user, ok := findUserByParamIn(c, database.DB.Unscoped())
+	if !ok {
+		return
+	}
+
+	var changes []models.UserStatusChange
+	if err := database.DB.Where("user_id = ?", user.ID).Order("id DESC").Find(&changes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve status history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"history": changes,
+	})
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// CreateAPIKeyRequest represents the request body for creating an API key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0"` // 0 uses API_KEY_MAX_LIFETIME
+}
+
+// apiKeyView returns the public fields of an API key
+func apiKeyView(key *models.APIKey) gin.H {
+	return gin.H{
+		"id":           key.ID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"scopes":       key.ScopeList(),
+		"created_at":   key.CreatedAt,
+		"expires_at":   key.ExpiresAt,
+		"last_used_at": key.LastUsedAt,
+	}
+}
+
+// CreateAPIKey creates an API key for the current user. The key is only
+// returned in this response, afterwards just its prefix is shown.
+func CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// API key scopes are the permission names, a key never grants more than its owner's role
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := make(map[string]bool, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if _, known := models.DefaultPermissions[scope]; !known {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	maxLifetime := config.GetAPIKeyMaxLifetime()
+	if maxLifetime > 0 && req.ExpiresInDays > maxLifetime {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("API keys can be valid for at most %d days", maxLifetime)})
+		return
+	}
+	lifetime := req.ExpiresInDays
+	if lifetime == 0 {
+		lifetime = maxLifetime
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if maxKeys := config.GetAPIKeyMaxPerUser(); int(count) >= maxKeys {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("You can have at most %d API keys, revoke one first", maxKeys),
+			"code":  "too_many_api_keys",
+		})
+		return
+	}
+
+	key, prefix, err := utils.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	apiKey := models.APIKey{
+		UserID:     userID.(uint),
+		Name:       req.Name,
+		Prefix:     prefix,
+		SecretHash: utils.HashToken(key),
+		Scopes:     strings.Join(scopes, ","),
+	}
+	if lifetime > 0 {
+		expiresAt := time.Now().AddDate(0, 0, lifetime)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := database.DB.Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	view := apiKeyView(&apiKey)
+	view["key"] = key
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Store this key now, it will not be shown again",
+		"api_key": view,
+	})
+}
+
+// ListAPIKeys returns the API keys of the current user that were not revoked
+func ListAPIKeys(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var keys []models.APIKey
+	result := database.DB.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at DESC").Find(&keys)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve API keys"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(keys))
+	for i := range keys {
+		items = append(items, apiKeyView(&keys[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"api_keys": items,
+	})
+}
+
+// RevokeAPIKey revokes an API key of the current user
+func RevokeAPIKey(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Check if the ID is a valid number
+	keyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	// Only keys owned by the current user can be revoked
+	var apiKey models.APIKey
+	result := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).First(&apiKey)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if err := database.DB.Model(&apiKey).Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "API key revoked successfully",
+	})
+}
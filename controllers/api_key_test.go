@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/middleware"
+	"ambridge-backend/models"
+)
+
+// newAPIKeyRouter serves endpoints guarded by a scope, by a permission and
+// for interactive logins only
+func newAPIKeyRouter(owner *models.User) *gin.Engine {
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	router := gin.New()
+	router.POST("/auth/api-keys", actingAs(owner), CreateAPIKey)
+	router.DELETE("/auth/api-keys/:id", actingAs(owner), RevokeAPIKey)
+
+	authRequired := router.Group("", middleware.AuthMiddleware())
+	authRequired.GET("/projects", middleware.RequireScope(models.PermissionProjectsWrite), ok)
+	authRequired.GET("/users", middleware.RequirePermission(models.PermissionUsersManage), ok)
+	authRequired.GET("/profile", middleware.RejectAPIKeys(), ok)
+	return router
+}
+
+// createTestAPIKey creates an API key with the given scopes and returns the key and its ID
+func createTestAPIKey(t *testing.T, router *gin.Engine, scopes ...string) (string, int) {
+	t.Helper()
+
+	w := performJSON(t, router, http.MethodPost, "/auth/api-keys", CreateAPIKeyRequest{Name: "CI", Scopes: scopes})
+	expectStatus(t, w, http.StatusCreated)
+	view, _ := decodeJSON(t, w)["api_key"].(map[string]interface{})
+	key, _ := view["key"].(string)
+	id, _ := view["id"].(float64)
+	return key, int(id)
+}
+
+// getWithAPIKey sends a GET request authenticated with an API key
+func getWithAPIKey(router *gin.Engine, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "ApiKey "+key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	admin := createTestUserWithRole(t, "api-key-admin@example.com", models.RoleAdmin)
+	router := newAPIKeyRouter(admin)
+	key, _ := createTestAPIKey(t, router, "Projects:Write ")
+
+	expectStatus(t, getWithAPIKey(router, "/projects", key), http.StatusOK)
+
+	// The owner's role grants users:manage, but the key does not hold the scope
+	expectCode(t, getWithAPIKey(router, "/users", key), http.StatusForbidden, "insufficient_scope")
+	expectCode(t, getWithAPIKey(router, "/profile", key), http.StatusForbidden, "api_key_not_allowed")
+
+	// An access token of the same user is not limited by scopes
+	token := generateTestJWT(t, admin)
+	expectStatus(t, getWithToken(router, "/users", token), http.StatusOK)
+}
+
+func TestAPIKeyScopeDoesNotExceedRole(t *testing.T) {
+	user := createTestUser(t, "api-key-user@example.com")
+	router := newAPIKeyRouter(user)
+	key, _ := createTestAPIKey(t, router, models.PermissionUsersManage)
+
+	expectCode(t, getWithAPIKey(router, "/users", key), http.StatusForbidden, "permission_denied")
+}
+
+func TestCreateAPIKeyRejectsUnknownScope(t *testing.T) {
+	user := createTestUser(t, "api-key-scope@example.com")
+	router := newAPIKeyRouter(user)
+
+	w := performJSON(t, router, http.MethodPost, "/auth/api-keys", CreateAPIKeyRequest{Name: "CI", Scopes: []string{"everything"}})
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestInvalidAPIKeysAreRejected(t *testing.T) {
+	user := createTestUser(t, "api-key-revoked@example.com")
+	router := newAPIKeyRouter(user)
+	key, id := createTestAPIKey(t, router, models.PermissionProjectsWrite)
+	expectStatus(t, getWithAPIKey(router, "/projects", key), http.StatusOK)
+
+	// A valid prefix with another secret is not the key
+	forged := key[:len(key)-4] + "0000"
+	if forged == key {
+		forged = key[:len(key)-4] + "1111"
+	}
+	expectCode(t, getWithAPIKey(router, "/projects", forged), http.StatusUnauthorized, "invalid_api_key")
+
+	w := performJSON(t, router, http.MethodDelete, "/auth/api-keys/"+strconv.Itoa(id), nil)
+	expectStatus(t, w, http.StatusOK)
+	expectCode(t, getWithAPIKey(router, "/projects", key), http.StatusUnauthorized, "invalid_api_key")
+}
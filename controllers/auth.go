@@ -2,13 +2,19 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"ambridge-backend/config"
 	"ambridge-backend/database"
+	"ambridge-backend/middleware"
 	"ambridge-backend/models"
 	"ambridge-backend/utils"
 )
@@ -18,11 +24,12 @@ type RegisterRequest struct {
 	Name            string `json:"name" binding:"required"`
 	Surname         string `json:"surname" binding:"required"`
 	Email           string `json:"email" binding:"required,email"`
-	Password        string `json:"password" binding:"required,min=6"`
+	Password        string `json:"password" binding:"required"`
 	ProfileImage    string `json:"profileImage"`
 	Referral        string `json:"referral"`
 	Company         string `json:"company"`
 	CurrentPosition string `json:"currentPosition"`
+	InviteCode      string `json:"invite_code"` // required when registration is invite-only
 }
 
 // LoginRequest represents the request body for user login
@@ -33,7 +40,7 @@ type LoginRequest struct {
 
 // RefreshTokenRequest represents the request body for token refresh
 type RefreshTokenRequest struct {
-	RefreshToken string `json:"refresh_token" binding:"required"`
+	RefreshToken string `json:"refresh_token"` // read from the cookie in cookie mode when empty
 }
 
 // UpdateProfileRequest represents the request body for updating user profile
@@ -58,10 +65,27 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	switch config.GetRegistrationMode() {
+	case config.RegistrationClosed:
+		recordAuthEvent(c, 0, models.AuthEventRegister, models.AuthOutcomeFailure, "Registration is closed")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is closed", "code": "registration_closed"})
+		return
+	case config.RegistrationInviteOnly:
+		if strings.TrimSpace(req.InviteCode) == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "An invitation is required to register", "code": "invitation_required"})
+			return
+		}
+	}
+
+	if !checkPasswordPolicy(c, req.Password, req.Email, req.Name, req.Surname) {
+		return
+	}
+
 	// Check if user already exists
 	var existingUser models.User
 	result := database.DB.Where("email = ?", strings.ToLower(req.Email)).First(&existingUser)
 	if result.Error == nil {
+		recordAuthEvent(c, existingUser.ID, models.AuthEventRegister, models.AuthOutcomeFailure, "Email already registered")
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
 		return
 	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -82,7 +106,8 @@ func Register(c *gin.Context) {
 		Surname:        req.Surname,
 		Email:          strings.ToLower(req.Email),
 		Password:       hashedPassword,
-		Role:           "user",
+		Role:           models.RoleUser,
+		Status:         models.UserStatusPending,
 		ProfileImage:   req.ProfileImage,
 		ReferralSource: req.Referral,
 		CompanyName:    req.Company,
@@ -94,14 +119,60 @@ func Register(c *gin.Context) {
 		user.ProfileImage = "/default-avatar.png"
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	// The invitation is used up together with creating the user, so a failed
+	// registration does not count against it
+	details := "Registered"
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.InviteCode != "" {
+			invitation, err := utils.ConsumeInvitation(tx, req.InviteCode, user.Email)
+			if err != nil {
+				return err
+			}
+			user.Role = invitation.Role
+			details = fmt.Sprintf("Registered with invitation %d", invitation.ID)
+
+			// The invitation was mailed to this address, so using it proves the address
+			if invitation.Email != "" {
+				now := time.Now()
+				user.Status = models.UserStatusActive
+				user.EmailVerifiedAt = &now
+			}
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvalidInvitation):
+			recordAuthEvent(c, 0, models.AuthEventRegister, models.AuthOutcomeFailure, "Invalid or expired invitation for "+utils.EmailReference(user.Email))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation", "code": "invalid_invitation"})
+		case errors.Is(err, gorm.ErrDuplicatedKey):
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		}
+		return
+	}
+
+	recordAuthEvent(c, user.ID, models.AuthEventRegister, models.AuthOutcomeSuccess, details)
+
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusCreated, gin.H{
+			"message":                     "User registered successfully",
+			"user_id":                     user.ID,
+			"email_verification_required": false,
+		})
 		return
 	}
 
+	// Send the email verification code; the user can request a new one if this fails
+	if err := sendVerificationEmail(&user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
-		"user_id": user.ID,
+		"message":                     "User registered successfully. Please verify your email address",
+		"user_id":                     user.ID,
+		"email_verification_required": true,
 	})
 }
 
@@ -113,11 +184,25 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	email := strings.ToLower(req.Email)
+
+	// Refuse guesses while the account or client is backing off
+	emailKey, ipKey := loginAttemptKeys(c, email)
+	if blockedUntil := loginBlockedUntil(emailKey, ipKey); time.Now().Before(blockedUntil) {
+		recordAuthEvent(c, 0, models.AuthEventLogin, models.AuthOutcomeFailure, "Login for "+utils.EmailReference(email)+" blocked after too many failures")
+		respondLoginLocked(c, blockedUntil)
+		return
+	}
+
 	// Find user by email
 	var user models.User
-	result := database.DB.Where("email = ?", strings.ToLower(req.Email)).First(&user)
+	result := database.DB.Where("email = ?", email).First(&user)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			// Spend the same time as a wrong password so unknown emails cannot be detected
+			utils.DummyPasswordCheck(req.Password)
+			recordLoginFailure(emailKey, ipKey)
+			recordAuthEvent(c, 0, models.AuthEventLogin, models.AuthOutcomeFailure, "No account for "+utils.EmailReference(email))
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -127,47 +212,98 @@ func Login(c *gin.Context) {
 
 	// Check password
 	if !utils.CheckPassword(user.Password, req.Password) {
+		recordLoginFailure(emailKey, ipKey)
+		recordAuthEvent(c, user.ID, models.AuthEventLogin, models.AuthOutcomeFailure, "Invalid password")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user.ID, user.Role)
+	// A correct password clears the account's failures; the IP counter keeps
+	// counting so one valid account cannot be used to reset it
+	if err := utils.Attempts().Reset(emailKey); err != nil {
+		log.Printf("Failed to reset login attempts of %s: %v", emailKey, err)
+	}
+
+	// The plaintext is only known now, so this is when weaker hashes are upgraded
+	if utils.PasswordNeedsRehash(user.Password) {
+		rehashPassword(&user, req.Password)
+	}
+
+	completeLogin(c, &user, "password")
+}
+
+// rehashPassword replaces the stored hash of a user with one made with the
+// current hashing settings. Failures are only logged, the old hash keeps working.
+func rehashPassword(user *models.User, password string) {
+	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		log.Printf("Failed to rehash password of user %d: %v", user.ID, err)
 		return
 	}
 
-	// Generate refresh token
-	refreshToken, err := utils.GenerateRefreshToken()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+	// Only replace the hash that was verified, not one set by a concurrent password change
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hashedPassword)
+	if result.Error != nil {
+		log.Printf("Failed to rehash password of user %d: %v", user.ID, result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		user.Password = hashedPassword
+	}
+}
+
+// completeLogin finishes a login once the user proved who they are with the
+// given method, either asking for the second factor or starting a session
+func completeLogin(c *gin.Context, user *models.User, method string) {
+	// Only active accounts can log in; pending accounts have not verified their email yet
+	if !checkAccountActive(c, user, models.AuthEventLogin) {
 		return
 	}
 
-	// Store refresh token in database
-	user.RefreshToken = refreshToken
+	// Accounts with two-factor authentication must complete a second step
+	if user.IsTOTPEnabled() {
+		mfaToken, err := utils.GeneratePurposeToken(user.ID, user.Role, utils.TokenPurposeMFA, mfaTokenTTL())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
 
-	if err := database.DB.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store refresh token"})
+		recordAuthEvent(c, user.ID, models.AuthEventLogin, models.AuthOutcomePending,
+			fmt.Sprintf("Logged in with %s, two-factor code required", method))
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token":         token,
-		"refresh_token": refreshToken,
-		"user": gin.H{
-			"id":              user.ID,
-			"name":            user.Name,
-			"surname":         user.Surname,
-			"email":           user.Email,
-			"role":            user.Role,
-			"profileImage":    user.ProfileImage,
-			"referral":        user.ReferralSource,
-			"company":         user.CompanyName,
-			"currentPosition": user.Position,
-		},
-	})
+	// Accounts with admin permissions must set up two-factor authentication first when it is mandatory
+	required, err := mfaRequired(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if required {
+		enrollmentToken, err := utils.GeneratePurposeToken(user.ID, user.Role, utils.TokenPurposeMFAEnrollment, mfaTokenTTL())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		recordAuthEvent(c, user.ID, models.AuthEventLogin, models.AuthOutcomePending,
+			fmt.Sprintf("Logged in with %s, two-factor setup required", method))
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":     "Two-factor authentication must be set up for accounts with admin permissions",
+			"code":      "mfa_enrollment_required",
+			"mfa_token": enrollmentToken,
+		})
+		return
+	}
+
+	// Start a new session for this device
+	respondWithSession(c, user, method, nil)
 }
 
 // Logout handles user logout
@@ -179,57 +315,127 @@ func Logout(c *gin.Context) {
 		return
 	}
 
-	// Clear refresh token in database
-	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).Update("refresh_token", "").Error; err != nil {
+	// Logging out of an impersonation only ends the impersonation, the user stays signed in
+	if actorID, impersonated := middleware.Impersonator(c); impersonated {
+		jti, _ := c.Get("token_id")
+		if err := utils.RevokeToken(jti.(string), userID.(uint), c.GetTime("token_expires_at")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+			return
+		}
+		recordAuthEvent(c, userID.(uint), models.AuthEventImpersonationEnded, models.AuthOutcomeSuccess, fmt.Sprintf("Impersonation ended by admin %d", actorID))
+		c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+		return
+	}
+
+	// Revoke the session of this token; tokens issued before sessions existed log out everywhere
+	var err error
+	details := "Logged out of all sessions"
+	if sessionID := currentSessionID(c); sessionID != 0 {
+		err = revokeSession(&models.Session{Model: gorm.Model{ID: sessionID}})
+		details = fmt.Sprintf("Logged out of session %d", sessionID)
+	} else {
+		err = revokeUserSessions(userID.(uint), 0)
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
 		return
 	}
 
+	// Revoke the access token itself
+	if jti, exists := c.Get("token_id"); exists {
+		if err := utils.RevokeToken(jti.(string), userID.(uint), c.GetTime("token_expires_at")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+			return
+		}
+	}
+
+	if config.GetAuthCookieMode() {
+		middleware.ClearAuthCookies(c)
+	}
+
+	recordAuthEvent(c, userID.(uint), models.AuthEventLogout, models.AuthOutcomeSuccess, details)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
 // RefreshToken handles token refresh
 func RefreshToken(c *gin.Context) {
 	var req RefreshTokenRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Find user by refresh token
-	var user models.User
-	result := database.DB.Where("refresh_token = ?", req.RefreshToken).First(&user)
-	if result.Error != nil {
+	// Browsers in cookie mode send the refresh token as a cookie, which needs the CSRF check
+	if req.RefreshToken == "" && config.GetAuthCookieMode() {
+		req.RefreshToken, _ = c.Cookie(middleware.RefreshTokenCookie)
+		if req.RefreshToken != "" && !middleware.CheckCSRF(c) {
+			return
+		}
+	}
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
+		return
+	}
+
+	// Find the refresh token and the session it belongs to
+	var record models.RefreshToken
+	if err := database.DB.Where("token_hash = ?", utils.HashToken(req.RefreshToken)).First(&record).Error; err != nil {
+		recordAuthEvent(c, 0, models.AuthEventTokenRefresh, models.AuthOutcomeFailure, "Unknown refresh token")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	// Generate new JWT token
-	token, err := utils.GenerateJWT(user.ID, user.Role)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+	var session models.Session
+	if err := database.DB.First(&session, record.SessionID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	// Generate new refresh token
-	refreshToken, err := utils.GenerateRefreshToken()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+	// A rotated token must never be presented again
+	if record.IsRotated() {
+		handleRefreshTokenReuse(c, &session)
+		return
+	}
+
+	if !session.IsActive() || time.Now().After(record.ExpiresAt) {
+		recordAuthEvent(c, session.UserID, models.AuthEventTokenRefresh, models.AuthOutcomeFailure,
+			fmt.Sprintf("Refresh token of session %d is expired or revoked", session.ID))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	// Store new refresh token in database
-	user.RefreshToken = refreshToken
+	// Find the session owner
+	var user models.User
+	if err := database.DB.First(&user, session.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if !checkAccountActive(c, &user, models.AuthEventTokenRefresh) {
+		return
+	}
 
-	if err := database.DB.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store refresh token"})
+	// Rotate the refresh token
+	refreshToken, err := rotateRefreshToken(c, &record, &session)
+	if err != nil {
+		if errors.Is(err, errRefreshTokenReused) {
+			handleRefreshTokenReuse(c, &session)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store refresh token"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token":         token,
-		"refresh_token": refreshToken,
-	})
+	// Generate new JWT token
+	token, err := utils.GenerateJWT(user.ID, user.Role, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	recordAuthEvent(c, user.ID, models.AuthEventTokenRefresh, models.AuthOutcomeSuccess, fmt.Sprintf("Session %d refreshed", session.ID))
+
+	writeTokens(c, gin.H{}, token, refreshToken)
 }
 
 // GetProfile retrieves the user's profile information
@@ -254,7 +460,7 @@ func GetProfile(c *gin.Context) {
 	}
 
 	// Return user profile data (excluding sensitive fields)
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"user": gin.H{
 			"name":            user.Name,
 			"surname":         user.Surname,
@@ -269,7 +475,14 @@ func GetProfile(c *gin.Context) {
 			"currentPosition": user.Position,
 			"resumeFile":      user.ResumeFile,
 		},
-	})
+	}
+
+	// Lets the frontend show that an admin is viewing the account
+	if actorID, impersonated := middleware.Impersonator(c); impersonated {
+		response["impersonated_by"] = actorID
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // AdminCheckRequest represents the request body for admin check
@@ -277,7 +490,8 @@ type AdminCheckRequest struct {
 	Username string `json:"username" binding:"required"`
 }
 
-// IsAdmin checks if the current user has admin role
+// IsAdmin checks if a user has the admin role. Users without the users:manage
+// permission can only check their own account.
 func IsAdmin(c *gin.Context) {
 	// Get user ID from JWT token (set by AuthMiddleware)
 	userID, exists := c.Get("user_id")
@@ -305,6 +519,21 @@ func IsAdmin(c *gin.Context) {
 		return
 	}
 
+	// Only users who manage accounts may look up other users' roles
+	if strings.ToLower(req.Username) != tokenUser.Email {
+		allowed, err := utils.HasPermission(tokenUser.Role, models.PermissionUsersManage)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !allowed {
+			recordAuthEvent(c, tokenUser.ID, models.AuthEventRoleLookup, models.AuthOutcomeFailure,
+				"Role lookup of another account without permission")
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only check your own account", "code": "permission_denied"})
+			return
+		}
+	}
+
 	// Find user by username (the user to check)
 	var targetUser models.User
 	result = database.DB.Where("email = ?", strings.ToLower(req.Username)).First(&targetUser)
@@ -317,8 +546,14 @@ func IsAdmin(c *gin.Context) {
 		return
 	}
 
+	// Lookups of other accounts are audited, checking one's own role is not
+	if targetUser.ID != tokenUser.ID {
+		recordAuthEvent(c, tokenUser.ID, models.AuthEventRoleLookup, models.AuthOutcomeSuccess,
+			fmt.Sprintf("Looked up the role of user %d", targetUser.ID))
+	}
+
 	// Check if target user has admin role
-	isAdmin := targetUser.Role == "admin"
+	isAdmin := targetUser.Role == models.RoleAdmin
 
 	// Return result
 	c.JSON(http.StatusOK, gin.H{
@@ -359,35 +594,46 @@ func UpdateProfile(c *gin.Context) {
 	}
 
 	// Update user fields if provided in the request
+	var fields []string
 	if req.Name != nil {
 		user.Name = *req.Name
+		fields = append(fields, "name")
 	}
 	if req.Surname != nil {
 		user.Surname = *req.Surname
+		fields = append(fields, "surname")
 	}
 	if req.ProfileImage != nil {
 		user.ProfileImage = *req.ProfileImage
+		fields = append(fields, "profileImage")
 	}
 	if req.Referral != nil {
 		user.ReferralSource = *req.Referral
+		fields = append(fields, "referral")
 	}
 	if req.Company != nil {
 		user.CompanyName = *req.Company
+		fields = append(fields, "company")
 	}
 	if req.CompanyEmail != nil {
 		user.CompanyEmail = *req.CompanyEmail
+		fields = append(fields, "companyEmail")
 	}
 	if req.CompanyAddress != nil {
 		user.CompanyAddress = *req.CompanyAddress
+		fields = append(fields, "companyAddress")
 	}
 	if req.CompanyPhone != nil {
 		user.CompanyPhone = *req.CompanyPhone
+		fields = append(fields, "companyPhone")
 	}
 	if req.CurrentPosition != nil {
 		user.Position = *req.CurrentPosition
+		fields = append(fields, "currentPosition")
 	}
 	if req.ResumeFile != nil {
 		user.ResumeFile = *req.ResumeFile
+		fields = append(fields, "resumeFile")
 	}
 
 	// Save updated user to database
@@ -396,6 +642,12 @@ func UpdateProfile(c *gin.Context) {
 		return
 	}
 
+	details := "Profile updated"
+	if len(fields) > 0 {
+		details = fmt.Sprintf("Profile updated (%s)", strings.Join(fields, ", "))
+	}
+	recordAuthEvent(c, user.ID, models.AuthEventProfileUpdate, models.AuthOutcomeSuccess, details)
+
 	// Return updated user profile
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Profile updated successfully",
@@ -415,3 +667,26 @@ func UpdateProfile(c *gin.Context) {
 		},
 	})
 }
+
+// loadCurrentUser loads the user of the token (set by AuthMiddleware), writing
+// the error response when the user cannot be loaded
+func loadCurrentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	var user models.User
+	result := database.DB.First(&user, userID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+
+	return &user, true
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+)
+
+// recordAuthEvent stores an authentication event for the user, or for no user
+// when userID is 0. Failures are only logged so that recording never blocks
+// the request.
+func recordAuthEvent(c *gin.Context, userID uint, eventType, outcome, details string) {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > models.MaxUserAgentLength {
+		userAgent = userAgent[:models.MaxUserAgentLength]
+	}
+
+	event := models.AuthEvent{
+		UserID:    userID,
+		Type:      eventType,
+		Outcome:   outcome,
+		IPAddress: c.ClientIP(),
+		UserAgent: userAgent,
+		Details:   details,
+	}
+	if err := database.DB.Create(&event).Error; err != nil {
+		log.Printf("Failed to record auth event %s for user %d: %v", eventType, userID, err)
+		return
+	}
+
+	log.Printf("[AUTH] %s (%s) for user %d from %s: %s", eventType, outcome, userID, event.IPAddress, details)
+}
+
+// Page sizes of the auth event endpoints
+const (
+	defaultAuthEventPageSize = 50
+	maxAuthEventPageSize     = 200
+	defaultActivityLimit     = 20
+)
+
+// ListAuthEvents returns a page of auth events, newest first, optionally
+// filtered by user, event type, outcome and a time range of RFC 3339 times
+func ListAuthEvents(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultAuthEventPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxAuthEventPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("page_size must be between 1 and %d", maxAuthEventPageSize)})
+		return
+	}
+
+	query := database.DB.Model(&models.AuthEvent{})
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := strconv.ParseUint(userID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		query = query.Where("user_id = ?", id)
+	}
+	if eventType := c.Query("type"); eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+	if outcome := c.Query("outcome"); outcome != "" {
+		query = query.Where("outcome = ?", outcome)
+	}
+	for _, bound := range []struct{ param, condition string }{
+		{"from", "created_at >= ?"},
+		{"to", "created_at < ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + " must be an RFC 3339 time"})
+			return
+		}
+		query = query.Where(bound.condition, t)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve auth events"})
+		return
+	}
+
+	var events []models.AuthEvent
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve auth events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"events": events,
+		"pagination": gin.H{
+			"page":      page,
+			"page_size": pageSize,
+			"total":     total,
+		},
+	})
+}
+
+// GetUserActivity returns the most recent auth events of a user, including deleted users
+func GetUserActivity(c *gin.Context) {
+	user, ok := findUserByParamIn(c, database.DB.Unscoped())
+	if !ok {
+		return
+	}
+
+	respondRecentActivity(c, user.ID)
+}
+
+// GetActivity returns the most recent auth events of the current user
+func GetActivity(c *gin.Context) {
+	// Get user ID from JWT token (set by AuthMiddleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	respondRecentActivity(c, userID.(uint))
+}
+
+// respondRecentActivity writes the latest auth events of a user, up to the
+// limit query parameter
+func respondRecentActivity(c *gin.Context, userID uint) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultActivityLimit)))
+	if err != nil || limit < 1 || limit > maxAuthEventPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxAuthEventPageSize)})
+		return
+	}
+
+	var events []models.AuthEvent
+	if err := database.DB.Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve activity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"events": events,
+	})
+}
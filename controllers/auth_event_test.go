@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+func TestFailedLoginForUnknownEmailIsPurgedWithAccount(t *testing.T) {
+	resetLoginAttempts(t)
+	withConfig(t, func(c *config.Config) { c.LoginBackoffBase = 0 })
+	router := gin.New()
+	router.POST("/auth/login", Login)
+
+	for _, email := range []string{"purge-later@example.com", "purge-bystander@example.com"} {
+		w := performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: email, Password: "Unknown-Account-1"})
+		expectStatus(t, w, http.StatusUnauthorized)
+	}
+
+	reference := utils.EmailReference("Purge-Later@example.com")
+	var events []models.AuthEvent
+	database.DB.Where("user_id = 0 AND details LIKE ?", "%"+reference+"%").Find(&events)
+	if len(events) != 1 {
+		t.Fatalf("Expected one event referencing the address, got %d", len(events))
+	}
+	if strings.Contains(events[0].Details, "purge-later") {
+		t.Fatalf("Event details contain the email address: %q", events[0].Details)
+	}
+
+	// The address is registered later, deleted and purged after the grace period
+	user := createTestUser(t, "purge-later@example.com")
+	err := database.DB.Model(user).Updates(map[string]interface{}{
+		"status":                models.UserStatusDeleted,
+		"deletion_requested_at": time.Now().AddDate(-1, 0, 0),
+	}).Error
+	if err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	utils.PurgeDeletedAccounts()
+
+	var remaining int64
+	database.DB.Model(&models.AuthEvent{}).Where("id = ?", events[0].ID).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("Event referencing the purged address was kept")
+	}
+	database.DB.Model(&models.AuthEvent{}).
+		Where("user_id = 0 AND details LIKE ?", "%"+utils.EmailReference("purge-bystander@example.com")+"%").
+		Count(&remaining)
+	if remaining != 1 {
+		t.Fatalf("Event of another address was purged")
+	}
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+)
+
+func TestLoginRehashesWeakerPassword(t *testing.T) {
+	resetLoginAttempts(t)
+	withConfig(t, func(c *config.Config) {
+		c.LoginBackoffBase = 0
+		c.PasswordHashAlgorithm = config.PasswordHashBcrypt
+		c.PasswordBcryptCost = 4
+	})
+	user := createTestUser(t, "rehash@example.com")
+	setTestPassword(t, user, "Rehash-Password-1")
+
+	storedHash := func() string {
+		var stored models.User
+		database.DB.First(&stored, user.ID)
+		return stored.Password
+	}
+	bcryptHash := storedHash()
+
+	// The account was created before the switch to argon2id
+	withConfig(t, func(c *config.Config) {
+		c.PasswordHashAlgorithm = config.PasswordHashArgon2id
+		c.PasswordArgon2Memory = 1024
+		c.PasswordArgon2Iterations = 1
+		c.PasswordArgon2Parallelism = 1
+	})
+	router := gin.New()
+	router.POST("/auth/login", Login)
+
+	w := performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Wrong-Password-1"})
+	expectStatus(t, w, http.StatusUnauthorized)
+	if storedHash() != bcryptHash {
+		t.Fatalf("A failed login replaced the hash")
+	}
+
+	w = performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Rehash-Password-1"})
+	expectStatus(t, w, http.StatusOK)
+	if hash := storedHash(); !strings.HasPrefix(hash, "$argon2id$") {
+		t.Fatalf("Hash was not upgraded to argon2id: %q", hash)
+	}
+
+	// The new hash works, and switching back to bcrypt does not downgrade it
+	withConfig(t, func(c *config.Config) { c.PasswordHashAlgorithm = config.PasswordHashBcrypt })
+	w = performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Rehash-Password-1"})
+	expectStatus(t, w, http.StatusOK)
+	if hash := storedHash(); !strings.HasPrefix(hash, "$argon2id$") {
+		t.Fatalf("Hash was downgraded: %q", hash)
+	}
+}
@@ -18,33 +18,9 @@ type CrewRequest struct {
 	URLPhoto string `json:"urlphoto"`
 }
 
-// IsAdmin checks if the user is an admin
-func isAdmin(c *gin.Context) bool {
-	// Get the user ID from the context (set by the auth middleware)
-	userID, exists := c.Get("user_id")
-	if !exists {
-		return false
-	}
-
-	// Get the user from the database
-	var user models.User
-	if result := database.DB.First(&user, userID); result.Error != nil {
-		return false
-	}
-
-	// Check if the user is an admin
-	return user.Role == "admin"
-}
-
 // CreateCrew handles the creation of a new crew member
-// Only admins can create crew members
+// Requires the crew:write permission
 func CreateCrew(c *gin.Context) {
-	// Check if the user is an admin
-	if !isAdmin(c) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create crew members"})
-		return
-	}
-
 	var request CrewRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -101,14 +77,8 @@ func GetCrewMember(c *gin.Context) {
 }
 
 // UpdateCrewMember updates a specific crew member
-// Only admins can update crew members
+// Requires the crew:write permission
 func UpdateCrewMember(c *gin.Context) {
-	// Check if the user is an admin
-	if !isAdmin(c) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can update crew members"})
-		return
-	}
-
 	id := c.Param("id")
 	var crew models.Crew
 
@@ -145,14 +115,8 @@ func UpdateCrewMember(c *gin.Context) {
 }
 
 // DeleteCrewMember removes a crew member from the database
-// Only admins can delete crew members
+// Requires the crew:write permission
 func DeleteCrewMember(c *gin.Context) {
-	// Check if the user is an admin
-	if !isAdmin(c) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can delete crew members"})
-		return
-	}
-
 	id := c.Param("id")
 
 	// Check if the ID is a valid number
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// ImpersonateRequest represents the request body for impersonating a user
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"max=255"` // stored in the audit trail
+}
+
+// ImpersonateUser issues a short-lived access token that lets an admin act as
+// a user. The token names the admin in its act claim, cannot be refreshed and
+// is rejected by sensitive endpoints; every request made with it is recorded.
+func ImpersonateUser(c *gin.Context) {
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := findUserByParam(c)
+	if !ok {
+		return
+	}
+
+	if rejectSelfAction(c, user) {
+		return
+	}
+
+	if user.Status != models.UserStatusActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only active accounts can be impersonated", "code": "account_" + user.Status})
+		return
+	}
+
+	// Impersonating must not give the admin permissions their own role lacks,
+	// nor let admins act as each other
+	actorRole, _ := c.Get("role")
+	allowed, err := canActAs(actorRole.(string), user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You can only impersonate users whose role has fewer permissions than yours",
+			"code":  "permission_denied",
+		})
+		return
+	}
+
+	actorID, _ := c.Get("user_id")
+	ttl := time.Duration(config.GetImpersonationExpiration()) * time.Minute
+	token, claims, err := utils.GenerateImpersonationToken(user.ID, user.Role, actorID.(uint), ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	details := "Impersonation started"
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		details = fmt.Sprintf("Impersonation started (%s)", reason)
+	}
+	auditAdminAction(c, user.ID, models.AuthEventImpersonationStarted, details)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":          "success",
+		"token":           token,
+		"expires_at":      claims.ExpiresAt.Time,
+		"impersonator_id": actorID,
+		"user":            adminUserView(user),
+	})
+}
+
+// canActAs reports whether a role grants every permission of another role and
+// at least one more, so that no role can act as an equal or higher one
+func canActAs(actorRole, targetRole string) (bool, error) {
+	if actorRole == targetRole {
+		return false, nil
+	}
+
+	actorPermissions, err := utils.RolePermissions(actorRole)
+	if err != nil {
+		return false, err
+	}
+	targetPermissions, err := utils.RolePermissions(targetRole)
+	if err != nil {
+		return false, err
+	}
+
+	for permission := range targetPermissions {
+		if !actorPermissions[permission] {
+			return false, nil
+		}
+	}
+	return len(actorPermissions) > len(targetPermissions), nil
+}
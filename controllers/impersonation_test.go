@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/database"
+	"ambridge-backend/middleware"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// createTestUserWithRole stores an active, verified user with the given role
+func createTestUserWithRole(t *testing.T, email, role string) *models.User {
+	t.Helper()
+
+	user := createTestUser(t, email)
+	if err := database.DB.Model(user).Update("role", role).Error; err != nil {
+		t.Fatalf("Failed to set role: %v", err)
+	}
+	return user
+}
+
+// actingAs authenticates every request as the given user
+func actingAs(user *models.User) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("role", user.Role)
+	}
+}
+
+func TestImpersonateRequiresLowerRole(t *testing.T) {
+	createTestRole(t, "support", models.PermissionUsersManage, models.PermissionUsersImpersonate)
+	admin := createTestUserWithRole(t, "impersonate-admin@example.com", models.RoleAdmin)
+	otherAdmin := createTestUserWithRole(t, "impersonate-other-admin@example.com", models.RoleAdmin)
+	support := createTestUserWithRole(t, "impersonate-support@example.com", "support")
+	otherSupport := createTestUserWithRole(t, "impersonate-other-support@example.com", "support")
+	user := createTestUser(t, "impersonate-user@example.com")
+
+	tests := []struct {
+		name   string
+		actor  *models.User
+		target *models.User
+		status int
+	}{
+		{"admin impersonates user", admin, user, http.StatusOK},
+		{"admin impersonates support", admin, support, http.StatusOK},
+		{"admin impersonates admin", admin, otherAdmin, http.StatusForbidden},
+		{"support impersonates support", support, otherSupport, http.StatusForbidden},
+		{"support impersonates admin", support, admin, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/admin/users/:id/impersonate", actingAs(tt.actor), ImpersonateUser)
+
+			w := performJSON(t, router, http.MethodPost, "/admin/users/"+strconv.Itoa(int(tt.target.ID))+"/impersonate", nil)
+			if tt.status == http.StatusForbidden {
+				expectCode(t, w, tt.status, "permission_denied")
+			} else {
+				expectStatus(t, w, tt.status)
+			}
+		})
+	}
+}
+
+func TestImpersonationTokenRejectedOnAdminRoutes(t *testing.T) {
+	admin := createTestUserWithRole(t, "impersonate-actor@example.com", models.RoleAdmin)
+	impersonated := createTestUserWithRole(t, "impersonate-target-admin@example.com", models.RoleAdmin)
+	user := createTestUser(t, "impersonate-victim@example.com")
+
+	// The admin group of routes.SetupAdminRoutes
+	router := gin.New()
+	adminRoutes := router.Group("/admin", middleware.AuthMiddleware(), middleware.RejectImpersonation())
+	adminRoutes.POST("/users/:id/suspend", middleware.RequirePermission(models.PermissionUsersManage), SuspendUser)
+
+	token, _, err := utils.GenerateImpersonationToken(impersonated.ID, impersonated.Role, admin.ID, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/"+strconv.Itoa(int(user.ID))+"/suspend", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	expectCode(t, w, http.StatusForbidden, "impersonation_not_allowed")
+
+	var unchanged models.User
+	database.DB.First(&unchanged, user.ID)
+	if unchanged.Status != models.UserStatusActive {
+		t.Fatalf("User was suspended with an impersonation token")
+	}
+}
+
+func TestStatusChangeNamesImpersonator(t *testing.T) {
+	admin := createTestUserWithRole(t, "status-impersonator@example.com", models.RoleAdmin)
+	user := createTestUser(t, "status-impersonated@example.com")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodDelete, "/auth/account", nil)
+	c.Set("user_id", user.ID)
+	c.Set("impersonator_id", admin.ID)
+
+	if err := changeUserStatus(c, user, models.UserStatusSuspended, "Test"); err != nil {
+		t.Fatalf("Failed to change status: %v", err)
+	}
+
+	var change models.UserStatusChange
+	if err := database.DB.Where("user_id = ?", user.ID).Last(&change).Error; err != nil {
+		t.Fatalf("Status change was not recorded: %v", err)
+	}
+	if change.ChangedBy == nil || *change.ChangedBy != admin.ID {
+		t.Fatalf("Status change recorded as made by %v instead of admin %d", change.ChangedBy, admin.ID)
+	}
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/mailer"
+	"ambridge-backend/middleware"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// CreateInvitationRequest represents the request body for creating an invitation
+type CreateInvitationRequest struct {
+	Email         string `json:"email" binding:"omitempty,email"` // binds the invitation to one address
+	Role          string `json:"role"`                            // defaults to the user role
+	MaxUses       int    `json:"max_uses" binding:"min=0"`        // defaults to 1, always 1 for email invitations
+	ExpiresInDays int    `json:"expires_in_days" binding:"min=0"` // 0 uses INVITATION_EXPIRATION
+}
+
+// invitationView returns the public fields of an invitation
+func invitationView(invitation *models.Invitation) gin.H {
+	return gin.H{
+		"id":         invitation.ID,
+		"email":      invitation.Email,
+		"role":       invitation.Role,
+		"max_uses":   invitation.MaxUses,
+		"use_count":  invitation.UseCount,
+		"active":     invitation.IsActive(),
+		"created_by": invitation.CreatedBy,
+		"created_at": invitation.CreatedAt,
+		"expires_at": invitation.ExpiresAt,
+		"revoked_at": invitation.RevokedAt,
+	}
+}
+
+// sendInvitationEmail mails an invite code to the address the invitation is bound to
+func sendInvitationEmail(invitation *models.Invitation, code string) error {
+	link := config.GetInvitationURL() + "?invite=" + url.QueryEscape(code) + "&email=" + url.QueryEscape(invitation.Email)
+
+	expiry := ""
+	if invitation.ExpiresAt != nil {
+		expiry = fmt.Sprintf(" The invitation expires on %s.", invitation.ExpiresAt.Format("2006-01-02"))
+	}
+
+	return mailer.Send(mailer.Message{
+		To:      invitation.Email,
+		Subject: "You are invited to Ambridge",
+		Body: fmt.Sprintf("Hi,\n\nYou have been invited to create an Ambridge account. Use this link to register:\n\n%s\n\n"+
+			"Your invite code is %s.%s", link, code, expiry),
+	})
+}
+
+// CreateInvitation creates an invitation to register. The invite code is only
+// returned in this response; invitations bound to an email are also mailed.
+func CreateInvitation(c *gin.Context) {
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email := strings.ToLower(req.Email)
+	maxUses := req.MaxUses
+	if maxUses == 0 || email != "" {
+		maxUses = 1
+	}
+
+	roleName := strings.ToLower(strings.TrimSpace(req.Role))
+	if roleName == "" {
+		roleName = models.RoleUser
+	}
+	var role models.Role
+	if result := database.DB.Where("name = ?", roleName).First(&role); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + req.Role})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	// Inviting someone into another role is assigning it, which needs roles:manage
+	if role.Name != models.RoleUser {
+		actorRole, _ := c.Get("role")
+		allowed, err := utils.HasPermission(actorRole.(string), models.PermissionRolesManage)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !allowed || !middleware.HasAPIKeyScope(c, models.PermissionRolesManage) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Inviting users with another role requires the " + models.PermissionRolesManage + " permission", "code": "permission_denied"})
+			return
+		}
+	}
+
+	if email != "" {
+		var count int64
+		if err := database.DB.Unscoped().Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+			return
+		}
+	}
+
+	code, err := utils.GenerateInvitationCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation"})
+		return
+	}
+
+	actorID, _ := c.Get("user_id")
+	invitation := models.Invitation{
+		CodeHash:  utils.HashToken(code),
+		Email:     email,
+		Role:      role.Name,
+		MaxUses:   maxUses,
+		CreatedBy: actorID.(uint),
+	}
+	lifetime := req.ExpiresInDays
+	if lifetime == 0 {
+		lifetime = config.GetInvitationExpiration()
+	}
+	if lifetime > 0 {
+		expiresAt := time.Now().AddDate(0, 0, lifetime)
+		invitation.ExpiresAt = &expiresAt
+	}
+	if err := database.DB.Create(&invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	if email != "" {
+		if err := sendInvitationEmail(&invitation, code); err != nil {
+			log.Printf("Failed to send invitation %d: %v", invitation.ID, err)
+		}
+	}
+
+	view := invitationView(&invitation)
+	view["code"] = code
+	c.JSON(http.StatusCreated, gin.H{
+		"status":     "success",
+		"message":    "Store this code now, it will not be shown again",
+		"invitation": view,
+	})
+}
+
+// ListInvitations returns the invitations, newest first. ?active=true only
+// returns invitations that can still be used.
+func ListInvitations(c *gin.Context) {
+	query := database.DB.Order("id DESC")
+	if c.Query("active") == "true" {
+		query = query.Where("revoked_at IS NULL AND use_count < max_uses AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+	}
+
+	var invitations []models.Invitation
+	if err := query.Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invitations"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(invitations))
+	for i := range invitations {
+		items = append(items, invitationView(&invitations[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "success",
+		"invitations": items,
+	})
+}
+
+// RevokeInvitation stops an invitation from being used. Accounts already
+// registered with it are not affected.
+func RevokeInvitation(c *gin.Context) {
+	// Check if the ID is a valid number
+	invitationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	var invitation models.Invitation
+	result := database.DB.Where("id = ? AND revoked_at IS NULL", invitationID).First(&invitation)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if err := database.DB.Model(&invitation).Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Invitation revoked successfully",
+	})
+}
@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/utils"
+)
+
+// JWKS publishes the public keys that verify access tokens so that other
+// services can validate them without holding the signing secret
+func JWKS(c *gin.Context) {
+	// Keys change on rotation only, allow short client side caching
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"keys": utils.PublicJWKS(),
+	})
+}
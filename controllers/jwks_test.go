@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+	"ambridge-backend/utils"
+)
+
+func TestJWKS(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "20240101000000-ed25519.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	withConfig(t, func(c *config.Config) {
+		c.JWTAlgorithm = "EdDSA"
+		c.JWTKeysDir = dir
+		c.JWTActiveKeyID = ""
+	})
+	if err := utils.LoadSigningKeys(); err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", JWKS)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("Cache-Control") == "" {
+		t.Fatalf("JWKS response is not cacheable")
+	}
+
+	keys, _ := decodeJSON(t, w)["keys"].([]interface{})
+	if len(keys) != 1 {
+		t.Fatalf("Expected one key, got %v", keys)
+	}
+	jwk, _ := keys[0].(map[string]interface{})
+	if jwk["kid"] != "20240101000000-ed25519" || jwk["kty"] != "OKP" || jwk["alg"] != "EdDSA" ||
+		jwk["x"] != base64.RawURLEncoding.EncodeToString(pub) {
+		t.Fatalf("Unexpected key %v", jwk)
+	}
+	if _, ok := jwk["d"]; ok {
+		t.Fatalf("JWKS published the private key")
+	}
+}
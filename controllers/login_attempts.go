@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+	"ambridge-backend/utils"
+)
+
+// loginAttemptKeys returns the attempt counters a login for email is checked against
+func loginAttemptKeys(c *gin.Context, email string) (string, string) {
+	return "email:" + email, "ip:" + c.ClientIP()
+}
+
+// loginBlockedUntil returns until when logins for the email or from the client IP
+// are refused. Store errors are logged and do not block the login.
+func loginBlockedUntil(emailKey, ipKey string) time.Time {
+	var blockedUntil time.Time
+
+	limits := map[string]int{
+		emailKey: config.GetLoginMaxFailures(),
+		ipKey:    config.GetLoginMaxFailuresPerIP(),
+	}
+	for key, maxFailures := range limits {
+		attempts, err := utils.Attempts().Get(key)
+		if err != nil {
+			log.Printf("Failed to read login attempts of %s: %v", key, err)
+			continue
+		}
+		if until := utils.LoginBlockedUntil(attempts, maxFailures); until.After(blockedUntil) {
+			blockedUntil = until
+		}
+	}
+
+	return blockedUntil
+}
+
+// recordLoginFailure counts a failed login for the email and the client IP
+func recordLoginFailure(keys ...string) {
+	for _, key := range keys {
+		if _, err := utils.Attempts().RecordFailure(key); err != nil {
+			log.Printf("Failed to record login failure of %s: %v", key, err)
+		}
+	}
+}
+
+// respondLoginLocked rejects a login attempt made during backoff or lockout
+func respondLoginLocked(c *gin.Context, blockedUntil time.Time) {
+	retryAfter := int(math.Ceil(time.Until(blockedUntil).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts, please try again later",
+		"code":        "login_locked",
+		"retry_after": retryAfter,
+	})
+}
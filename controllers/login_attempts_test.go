@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+	"ambridge-backend/models"
+)
+
+// newLoginRouter routes the login and the admin unlock endpoint
+func newLoginRouter(admin *models.User) *gin.Engine {
+	router := gin.New()
+	router.POST("/auth/login", Login)
+	router.POST("/admin/users/:id/unlock", actingAs(admin), UnlockUser)
+	return router
+}
+
+func TestLoginBackoff(t *testing.T) {
+	resetLoginAttempts(t)
+	withConfig(t, func(c *config.Config) { c.LoginBackoffBase = 60 })
+	user := createTestUser(t, "backoff@example.com")
+	setTestPassword(t, user, "Backoff-Password-1")
+	router := newLoginRouter(user)
+
+	w := performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Wrong-Password-1"})
+	expectStatus(t, w, http.StatusUnauthorized)
+
+	// Even the right password waits for the backoff
+	w = performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Backoff-Password-1"})
+	expectCode(t, w, http.StatusTooManyRequests, "login_locked")
+	if retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retryAfter < 59 || retryAfter > 60 {
+		t.Fatalf("Unexpected Retry-After %q", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestLoginLockoutAndUnlock(t *testing.T) {
+	resetLoginAttempts(t)
+	withConfig(t, func(c *config.Config) {
+		c.LoginBackoffBase = 0
+		c.LoginMaxFailures = 3
+		c.LoginLockoutDuration = 15
+	})
+	admin := createTestUserWithRole(t, "lockout-admin@example.com", models.RoleAdmin)
+	user := createTestUser(t, "lockout@example.com")
+	setTestPassword(t, user, "Lockout-Password-1")
+	router := newLoginRouter(admin)
+
+	for i := 0; i < 3; i++ {
+		w := performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Wrong-Password-1"})
+		expectStatus(t, w, http.StatusUnauthorized)
+	}
+	w := performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Lockout-Password-1"})
+	expectCode(t, w, http.StatusTooManyRequests, "login_locked")
+
+	w = performJSON(t, router, http.MethodPost, "/admin/users/"+strconv.Itoa(int(user.ID))+"/unlock", nil)
+	expectStatus(t, w, http.StatusOK)
+
+	w = performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Lockout-Password-1"})
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestLoginLockoutPerIP(t *testing.T) {
+	resetLoginAttempts(t)
+	withConfig(t, func(c *config.Config) {
+		c.LoginBackoffBase = 0
+		c.LoginMaxFailuresPerIP = 3
+	})
+	user := createTestUser(t, "lockout-ip@example.com")
+	setTestPassword(t, user, "Lockout-Password-1")
+	router := newLoginRouter(user)
+
+	// Guesses spread over many addresses still lock out the client
+	for _, email := range []string{"guess-1@example.com", "guess-2@example.com", "guess-3@example.com"} {
+		w := performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: email, Password: "Wrong-Password-1"})
+		expectStatus(t, w, http.StatusUnauthorized)
+	}
+	w := performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Lockout-Password-1"})
+	expectCode(t, w, http.StatusTooManyRequests, "login_locked")
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/mailer"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// MagicLinkRequest represents the request body for requesting a login link
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ConsumeMagicLinkRequest represents the request body for logging in with a login link
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+var (
+	magicLinkLimiter     *utils.RateLimiter
+	magicLinkLimiterOnce sync.Once
+)
+
+// magicLinkRateLimiter returns the per-email rate limiter for login link requests
+func magicLinkRateLimiter() *utils.RateLimiter {
+	magicLinkLimiterOnce.Do(func() {
+		magicLinkLimiter = utils.NewRateLimiter(config.GetMagicLinkRateLimit(), time.Hour)
+	})
+	return magicLinkLimiter
+}
+
+// sendMagicLinkEmail issues a login link and mails it to the user
+func sendMagicLinkEmail(user *models.User) error {
+	ttl := time.Duration(config.GetMagicLinkExpiration()) * time.Minute
+	token, err := utils.GenerateMagicLinkToken(user.ID, user.Role, user.Email, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := config.GetMagicLinkURL() + "?token=" + url.QueryEscape(token)
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Ambridge login link",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to log in to Ambridge:\n\n%s\n\nThe link can be used once and expires in %d minutes. "+
+			"If you did not request it you can ignore this email.",
+			user.Name, link, config.GetMagicLinkExpiration()),
+	})
+}
+
+// RequestMagicLink emails a single-use login link to the user.
+// The response is the same whether or not the email is registered.
+func RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email := strings.ToLower(req.Email)
+
+	// Rate limit per email address, registered or not
+	if !magicLinkRateLimiter().Allow(email) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many login link requests, please try again later", "code": "too_many_requests"})
+		return
+	}
+
+	// Look up and email the user in the background so the response time does not
+	// reveal whether the account exists
+	go func() {
+		var user models.User
+		if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Failed to look up user for login link: %v", err)
+			}
+			return
+		}
+
+		if err := sendMagicLinkEmail(&user); err != nil {
+			log.Printf("Failed to send login link to user %d: %v", user.ID, err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a login link has been sent"})
+}
+
+// ConsumeMagicLink logs the user in with the token of a login link. Each link
+// works once and only while the account still uses the email it was sent to.
+func ConsumeMagicLink(c *gin.Context) {
+	var req ConsumeMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := utils.VerifyPurposeToken(req.Token, utils.TokenPurposeMagicLink)
+	if err != nil {
+		respondInvalidMagicLink(c)
+		return
+	}
+	userID, _ := claims.UserID()
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil || user.Email != claims.Email {
+		respondInvalidMagicLink(c)
+		return
+	}
+
+	first, err := utils.ConsumeToken(claims.ID, user.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !first {
+		respondInvalidMagicLink(c)
+		return
+	}
+
+	// Following the link proves the address, which is all a pending account was waiting for
+	if user.Status == models.UserStatusPending {
+		if err := claimPendingAccount(c, &user, "Email verified by login link"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate account"})
+			return
+		}
+	}
+
+	completeLogin(c, &user, "login link")
+}
+
+// respondInvalidMagicLink rejects an unknown, expired or already used login link
+func respondInvalidMagicLink(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login link", "code": "invalid_magic_link"})
+}
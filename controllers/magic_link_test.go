@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+func TestMagicLinkClaimsPendingAccount(t *testing.T) {
+	router := gin.New()
+	router.POST("/auth/magic-link/consume", ConsumeMagicLink)
+
+	// Someone registered the address with their own password but never verified it
+	hashedPassword, err := utils.HashPassword("Attacker-Password-1")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	user := createTestUser(t, "magic-pending@example.com")
+	database.DB.Model(user).Updates(map[string]interface{}{
+		"status": models.UserStatusPending, "password": hashedPassword, "email_verified_at": nil,
+	})
+
+	token, err := utils.GenerateMagicLinkToken(user.ID, user.Role, user.Email, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate login link: %v", err)
+	}
+	w := performJSON(t, router, http.MethodPost, "/auth/magic-link/consume", ConsumeMagicLinkRequest{Token: token})
+	expectStatus(t, w, http.StatusOK)
+
+	var claimed models.User
+	database.DB.First(&claimed, user.ID)
+	if claimed.Status != models.UserStatusActive || claimed.EmailVerifiedAt == nil {
+		t.Fatalf("Account was not activated: %+v", claimed)
+	}
+	if claimed.Password != "" {
+		t.Fatalf("The registrant's password still works after the owner claimed the account")
+	}
+
+	// Each link works once
+	w = performJSON(t, router, http.MethodPost, "/auth/magic-link/consume", ConsumeMagicLinkRequest{Token: token})
+	expectCode(t, w, http.StatusUnauthorized, "invalid_magic_link")
+}
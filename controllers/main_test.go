@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// TestMain runs the controller tests against a temporary SQLite database with
+// the default configuration. Tests share the database, so each one uses its
+// own email addresses and identities.
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	config.LoadConfig()
+
+	dir, err := os.MkdirTemp("", "ambridge-test")
+	if err != nil {
+		log.Fatalf("Failed to create test directory: %v", err)
+	}
+
+	dsn := filepath.Join(dir, "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	database.DB, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open test database: %v", err)
+	}
+
+	err = database.DB.AutoMigrate(
+		&models.User{},
+		&models.VerificationCode{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.AuthEvent{},
+		&models.RevokedToken{},
+		&models.RecoveryCode{},
+		&models.LoginAttempt{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserStatusChange{},
+		&models.APIKey{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.Passkey{},
+		&models.PasskeyChallenge{},
+	)
+	if err != nil {
+		log.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	if err := seedTestRoles(); err != nil {
+		log.Fatalf("Failed to seed roles: %v", err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// performJSON sends a JSON request to the router and returns the recorded response
+func performJSON(t *testing.T, router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// decodeJSON decodes a recorded JSON response
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid JSON response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+// expectStatus fails the test when the response has another status code
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+
+	if w.Code != status {
+		t.Fatalf("Expected status %d, got %d: %s", status, w.Code, w.Body.String())
+	}
+}
+
+// expectCode fails the test when the error response has another code
+func expectCode(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	expectStatus(t, w, status)
+	if got := decodeJSON(t, w)["code"]; got != code {
+		t.Fatalf("Expected code %q, got %v", code, got)
+	}
+}
+
+// createTestUser stores an active, verified user
+func createTestUser(t *testing.T, email string) *models.User {
+	t.Helper()
+
+	user := &models.User{
+		Name:   "Test",
+		Email:  email,
+		Role:   models.RoleUser,
+		Status: models.UserStatusActive,
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	if err := database.DB.Create(user).Error; err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return user
+}
+
+// seedTestRoles creates the built-in permissions and roles, as
+// database.SeedRoles does on MySQL
+func seedTestRoles() error {
+	var permissions []models.Permission
+	for name, description := range models.DefaultPermissions {
+		permissions = append(permissions, models.Permission{Name: name, Description: description})
+	}
+	if err := database.DB.Create(&permissions).Error; err != nil {
+		return err
+	}
+
+	roles := []models.Role{
+		{Name: models.RoleAdmin, Description: "Administrator with every permission", Permissions: permissions},
+		{Name: models.RoleUser, Description: "Regular user"},
+	}
+	return database.DB.Create(&roles).Error
+}
+
+// createTestRole stores a role with the given permissions
+func createTestRole(t *testing.T, name string, permissions ...string) {
+	t.Helper()
+
+	role := models.Role{Name: name}
+	if len(permissions) > 0 {
+		if err := database.DB.Where("name IN ?", permissions).Find(&role.Permissions).Error; err != nil {
+			t.Fatalf("Failed to load permissions: %v", err)
+		}
+	}
+	if err := database.DB.Create(&role).Error; err != nil {
+		t.Fatalf("Failed to create role: %v", err)
+	}
+}
+
+// withConfig changes the configuration for the rest of the test
+func withConfig(t *testing.T, change func(*config.Config)) {
+	t.Helper()
+
+	saved := *config.AppConfig
+	change(config.AppConfig)
+	t.Cleanup(func() { *config.AppConfig = saved })
+}
+
+// setTestPassword stores a hash of the password for the user
+func setTestPassword(t *testing.T, user *models.User, password string) {
+	t.Helper()
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if err := database.DB.Model(user).Update("password", hashedPassword).Error; err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+}
+
+// resetLoginAttempts keeps the failed logins of the test apart from those of
+// other tests, which all come from the same client IP
+func resetLoginAttempts(t *testing.T) {
+	t.Helper()
+
+	utils.SetAttemptStore(utils.NewMemoryAttemptStore())
+	t.Cleanup(func() { utils.SetAttemptStore(utils.NewMemoryAttemptStore()) })
+}
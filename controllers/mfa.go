@@ -0,0 +1,443 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// recoveryCodeCount is the number of recovery codes issued at once
+const recoveryCodeCount = 10
+
+// TOTPCodeRequest represents a request body carrying a TOTP code
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// LoginMFARequest represents the request body for the second login step
+type LoginMFARequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// EnrollTOTPRequest represents the request body for starting two-factor enrollment
+type EnrollTOTPRequest struct {
+	Password string `json:"password"` // required unless an enrollment token from login is used
+}
+
+// DisableTOTPRequest represents the request body for disabling two-factor authentication
+type DisableTOTPRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP or recovery code
+}
+
+var (
+	mfaLimiter     *utils.RateLimiter
+	mfaLimiterOnce sync.Once
+)
+
+// secondFactorLimiter limits second factor attempts per user
+func secondFactorLimiter() *utils.RateLimiter {
+	mfaLimiterOnce.Do(func() {
+		mfaLimiter = utils.NewRateLimiter(5, 5*time.Minute)
+	})
+	return mfaLimiter
+}
+
+// mfaRequired reports whether the user must use two-factor authentication,
+// which MFA_REQUIRED_FOR_ADMIN demands of every role with a privileged permission
+func mfaRequired(user *models.User) (bool, error) {
+	if !config.GetMFARequiredForAdmin() {
+		return false, nil
+	}
+
+	permissions, err := utils.RolePermissions(user.Role)
+	if err != nil {
+		return false, err
+	}
+	for _, permission := range models.PrivilegedPermissions {
+		if permissions[permission] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// mfaTokenTTL returns the lifetime of the tokens issued between the login steps
+func mfaTokenTTL() time.Duration {
+	return time.Duration(config.GetMFATokenExpiration()) * time.Minute
+}
+
+// verifyTOTP checks a TOTP code and records its time step so it cannot be replayed
+func verifyTOTP(user *models.User, code string) (bool, error) {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_used_step < ?", user.ID, step).
+		Update("totp_last_used_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// useRecoveryCode consumes one of the user's unused recovery codes
+func useRecoveryCode(userID uint, code string) (bool, error) {
+	result := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(utils.NormalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or a recovery code
+func verifySecondFactor(user *models.User, code string) (bool, error) {
+	if len(code) == 6 {
+		if ok, err := verifyTOTP(user, code); ok || err != nil {
+			return ok, err
+		}
+	}
+	return useRecoveryCode(user.ID, code)
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and issues a new set
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(utils.NormalizeRecoveryCode(code)),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// EnrollTOTP generates a new TOTP secret for the current user. Two-factor
+// authentication is enabled once the first code is confirmed. With an access
+// token the current password is required, so that a stolen token cannot bind
+// another authenticator; the enrollment token of a login was only just issued.
+func EnrollTOTP(c *gin.Context) {
+	var req EnrollTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.IsTOTPEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	if !c.GetBool("mfa_enrollment") {
+		if req.Password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Password is required"})
+			return
+		}
+		if !checkCurrentPassword(c, user, req.Password) {
+			return
+		}
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	if err := database.DB.Model(user).Update("totp_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(secret, user.Email, config.GetMFAIssuer()),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication with the first code from the
+// authenticator app and returns the recovery codes
+func ConfirmTOTP(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.IsTOTPEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor enrollment has not been started"})
+		return
+	}
+
+	if !secondFactorLimiter().Allow(user.Email) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, please try again later", "code": "too_many_attempts"})
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(user.TOTPSecret, req.Code, time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code", "code": "invalid_code"})
+		return
+	}
+
+	// Enrollment during login only completes the login of an account that is still active
+	enrollment := c.GetBool("mfa_enrollment")
+	if enrollment && !checkAccountActive(c, user, models.AuthEventLogin) {
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if codes, err = replaceRecoveryCodes(tx, user.ID); err != nil {
+			return err
+		}
+
+		return tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled_at":     time.Now(),
+			"totp_last_used_step": step,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	// Enrollment during login: the enrollment token is spent and the login completes
+	if enrollment {
+		if err := utils.RevokeToken(c.GetString("token_id"), user.ID, c.GetTime("token_expires_at")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+			return
+		}
+
+		respondWithSession(c, user, "two-factor setup", gin.H{
+			"message":        "Two-factor authentication enabled",
+			"recovery_codes": codes,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP turns off two-factor authentication for the current user
+func DisableTOTP(c *gin.Context) {
+	var req DisableTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.IsTOTPEnabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	required, err := mfaRequired(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is mandatory for accounts with admin permissions"})
+		return
+	}
+
+	if !secondFactorLimiter().Allow(user.Email) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, please try again later", "code": "too_many_attempts"})
+		return
+	}
+
+	if !utils.CheckPassword(user.Password, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	valid, err := verifySecondFactor(user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code", "code": "invalid_code"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":         "",
+			"totp_enabled_at":     nil,
+			"totp_last_used_step": 0,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.IsTOTPEnabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if !secondFactorLimiter().Allow(user.Email) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, please try again later", "code": "too_many_attempts"})
+		return
+	}
+
+	valid, err := verifyTOTP(user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code", "code": "invalid_code"})
+		return
+	}
+
+	var codes []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// LoginMFA completes a login with the token returned by Login and a TOTP or recovery code
+func LoginMFA(c *gin.Context) {
+	var req LoginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := utils.VerifyPurposeToken(req.MFAToken, utils.TokenPurposeMFA)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if revoked, err := utils.IsTokenRevoked(claims.ID); err != nil || revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	userID, _ := claims.UserID()
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil || !user.IsTOTPEnabled() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	if !secondFactorLimiter().Allow(user.Email) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, please try again later", "code": "too_many_attempts"})
+		return
+	}
+
+	var valid bool
+	var method string
+	switch {
+	case req.Code != "":
+		valid, err = verifyTOTP(&user, req.Code)
+		method = "two-factor code"
+	case req.RecoveryCode != "":
+		valid, err = useRecoveryCode(user.ID, req.RecoveryCode)
+		method = "recovery code"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !valid {
+		recordAuthEvent(c, user.ID, models.AuthEventLogin, models.AuthOutcomeFailure, "Invalid "+method)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code", "code": "invalid_code"})
+		return
+	}
+
+	// The MFA token can only complete one login
+	if err := utils.RevokeToken(claims.ID, user.ID, claims.ExpiresAt.Time); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	respondWithSession(c, &user, method, nil)
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/middleware"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// totpCodeAt computes the code an authenticator app shows for the secret at the given time
+func totpCodeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("Invalid TOTP secret: %v", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// enableTestTOTP turns on two-factor authentication for the user and returns the secret
+func enableTestTOTP(t *testing.T, user *models.User) string {
+	t.Helper()
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Failed to generate secret: %v", err)
+	}
+	err = database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_secret":     secret,
+		"totp_enabled_at": time.Now(),
+	}).Error
+	if err != nil {
+		t.Fatalf("Failed to enable two-factor authentication: %v", err)
+	}
+	return secret
+}
+
+// newMFARouter routes the two-factor endpoints as routes.SetupAuthRoutes does
+func newMFARouter() *gin.Engine {
+	router := gin.New()
+	router.POST("/auth/login", Login)
+	router.POST("/auth/login/2fa", LoginMFA)
+	enrollment := router.Group("/auth/2fa", middleware.MFAEnrollmentMiddleware())
+	enrollment.POST("/enroll", EnrollTOTP)
+	enrollment.POST("/confirm", ConfirmTOTP)
+	return router
+}
+
+// performWithToken sends a JSON request authenticated with a bearer token
+func performWithToken(t *testing.T, router *gin.Engine, path, token string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestEnrollTOTPRequiresPassword(t *testing.T) {
+	user := createTestUser(t, "mfa-enroll@example.com")
+	setTestPassword(t, user, "Correct-Password-1")
+
+	router := gin.New()
+	router.POST("/auth/2fa/enroll", actingAs(user), EnrollTOTP)
+
+	w := performJSON(t, router, http.MethodPost, "/auth/2fa/enroll", EnrollTOTPRequest{})
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = performJSON(t, router, http.MethodPost, "/auth/2fa/enroll", EnrollTOTPRequest{Password: "Wrong-Password-1"})
+	expectCode(t, w, http.StatusUnauthorized, "invalid_password")
+
+	var unchanged models.User
+	database.DB.First(&unchanged, user.ID)
+	if unchanged.TOTPSecret != "" {
+		t.Fatalf("Enrollment started without the password")
+	}
+
+	w = performJSON(t, router, http.MethodPost, "/auth/2fa/enroll", EnrollTOTPRequest{Password: "Correct-Password-1"})
+	expectStatus(t, w, http.StatusOK)
+	if decodeJSON(t, w)["secret"] == "" {
+		t.Fatalf("Enrollment returned no secret")
+	}
+}
+
+func TestMFARequiredForPrivilegedRoles(t *testing.T) {
+	resetLoginAttempts(t)
+	withConfig(t, func(c *config.Config) { c.MFARequiredForAdmin = true })
+	createTestRole(t, "moderator", models.PermissionUsersManage)
+	moderator := createTestUserWithRole(t, "mfa-moderator@example.com", "moderator")
+	setTestPassword(t, moderator, "Moderator-Password-1")
+	user := createTestUser(t, "mfa-regular@example.com")
+	setTestPassword(t, user, "Regular-Password-1")
+	router := newMFARouter()
+
+	w := performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: moderator.Email, Password: "Moderator-Password-1"})
+	expectCode(t, w, http.StatusForbidden, "mfa_enrollment_required")
+	if _, ok := decodeJSON(t, w)["token"]; ok {
+		t.Fatalf("Login returned a session before two-factor setup")
+	}
+
+	w = performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Regular-Password-1"})
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestEnrollmentDuringLogin(t *testing.T) {
+	user := createTestUser(t, "mfa-enrollment@example.com")
+	router := newMFARouter()
+
+	token, err := utils.GeneratePurposeToken(user.ID, user.Role, utils.TokenPurposeMFAEnrollment, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	// The enrollment token stands in for the password that was just checked
+	w := performWithToken(t, router, "/auth/2fa/enroll", token, "")
+	expectStatus(t, w, http.StatusOK)
+	secret, _ := decodeJSON(t, w)["secret"].(string)
+
+	w = performWithToken(t, router, "/auth/2fa/confirm", token, `{"code":"`+totpCodeAt(t, secret, time.Now())+`"}`)
+	expectStatus(t, w, http.StatusOK)
+	body := decodeJSON(t, w)
+	for _, key := range []string{"user", "token", "refresh_token", "recovery_codes"} {
+		if _, ok := body[key]; !ok {
+			t.Fatalf("Enrollment response is missing %q: %v", key, body)
+		}
+	}
+
+	var event models.AuthEvent
+	err = database.DB.Where("user_id = ? AND type = ? AND outcome = ?", user.ID, models.AuthEventLogin, models.AuthOutcomeSuccess).
+		First(&event).Error
+	if err != nil {
+		t.Fatalf("Login was not recorded: %v", err)
+	}
+
+	// The enrollment token completes a single login
+	w = performWithToken(t, router, "/auth/2fa/confirm", token, `{"code":"000000"}`)
+	expectCode(t, w, http.StatusUnauthorized, "token_revoked")
+}
+
+func TestEnrollmentDuringLoginRejectsSuspendedAccount(t *testing.T) {
+	user := createTestUser(t, "mfa-suspended@example.com")
+	router := newMFARouter()
+
+	token, err := utils.GeneratePurposeToken(user.ID, user.Role, utils.TokenPurposeMFAEnrollment, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	w := performWithToken(t, router, "/auth/2fa/enroll", token, "")
+	expectStatus(t, w, http.StatusOK)
+	secret, _ := decodeJSON(t, w)["secret"].(string)
+
+	// Suspended between the password step and the confirmation
+	database.DB.Model(user).Update("status", models.UserStatusSuspended)
+
+	w = performWithToken(t, router, "/auth/2fa/confirm", token, `{"code":"`+totpCodeAt(t, secret, time.Now())+`"}`)
+	expectCode(t, w, http.StatusForbidden, "account_suspended")
+
+	var sessions int64
+	database.DB.Model(&models.Session{}).Where("user_id = ?", user.ID).Count(&sessions)
+	if sessions != 0 {
+		t.Fatalf("Suspended account received a session")
+	}
+}
+
+func TestLoginWithSecondFactor(t *testing.T) {
+	resetLoginAttempts(t)
+	user := createTestUser(t, "mfa-login@example.com")
+	setTestPassword(t, user, "Second-Factor-1")
+	secret := enableTestTOTP(t, user)
+	router := newMFARouter()
+
+	login := func() string {
+		t.Helper()
+
+		w := performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Second-Factor-1"})
+		expectStatus(t, w, http.StatusOK)
+		body := decodeJSON(t, w)
+		if body["mfa_required"] != true {
+			t.Fatalf("Login skipped the second factor: %v", body)
+		}
+		return body["mfa_token"].(string)
+	}
+
+	mfaToken := login()
+	code := totpCodeAt(t, secret, time.Now())
+	w := performJSON(t, router, http.MethodPost, "/auth/login/2fa", LoginMFARequest{MFAToken: mfaToken, Code: code})
+	expectStatus(t, w, http.StatusOK)
+
+	// Neither the MFA token nor the code can be used twice
+	w = performJSON(t, router, http.MethodPost, "/auth/login/2fa", LoginMFARequest{MFAToken: mfaToken, Code: code})
+	expectStatus(t, w, http.StatusUnauthorized)
+	w = performJSON(t, router, http.MethodPost, "/auth/login/2fa", LoginMFARequest{MFAToken: login(), Code: code})
+	expectCode(t, w, http.StatusUnauthorized, "invalid_code")
+}
+
+func TestLoginWithRecoveryCode(t *testing.T) {
+	resetLoginAttempts(t)
+	user := createTestUser(t, "mfa-recovery@example.com")
+	setTestPassword(t, user, "Recovery-Code-1")
+	enableTestTOTP(t, user)
+	codes, err := replaceRecoveryCodes(database.DB, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to create recovery codes: %v", err)
+	}
+	router := newMFARouter()
+
+	mfaToken := func() string {
+		t.Helper()
+
+		w := performJSON(t, router, http.MethodPost, "/auth/login", LoginRequest{Email: user.Email, Password: "Recovery-Code-1"})
+		expectStatus(t, w, http.StatusOK)
+		return decodeJSON(t, w)["mfa_token"].(string)
+	}
+
+	// Codes are accepted without the dash and in upper case
+	code := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	w := performJSON(t, router, http.MethodPost, "/auth/login/2fa", LoginMFARequest{MFAToken: mfaToken(), RecoveryCode: code})
+	expectStatus(t, w, http.StatusOK)
+
+	w = performJSON(t, router, http.MethodPost, "/auth/login/2fa", LoginMFARequest{MFAToken: mfaToken(), RecoveryCode: codes[0]})
+	expectCode(t, w, http.StatusUnauthorized, "invalid_code")
+}
@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// OIDCCallbackRequest represents the request body for completing a social login
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+var (
+	// errOIDCEmailNotVerified is returned when a new identity has no verified email to match or register
+	errOIDCEmailNotVerified = errors.New("provider did not return a verified email address")
+	// errOIDCRegistrationClosed is returned when a new identity would need a new account
+	// while registration is not open
+	errOIDCRegistrationClosed = errors.New("registration is not open")
+)
+
+// oidcRedirectURL returns the frontend URL the provider sends the user back to
+func oidcRedirectURL(provider string) string {
+	return strings.TrimSuffix(config.GetOIDCRedirectURL(), "/") + "/" + provider
+}
+
+// findOIDCProvider returns the provider named in the URL, answering 404 for unknown ones
+func findOIDCProvider(c *gin.Context) (utils.OIDCProvider, bool) {
+	provider, ok := utils.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return nil, false
+	}
+	return provider, true
+}
+
+// ListOIDCProviders returns the names of the configured social login providers
+func ListOIDCProviders(c *gin.Context) {
+	names := utils.OIDCProviderNames()
+	sort.Strings(names)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"providers": names,
+	})
+}
+
+// StartOIDCLogin returns the provider URL the user is sent to for signing in.
+// The state, nonce and PKCE verifier are kept until the callback.
+func StartOIDCLogin(c *gin.Context) {
+	provider, ok := findOIDCProvider(c)
+	if !ok {
+		return
+	}
+
+	state, err := utils.GenerateOIDCState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	nonce, err := utils.GenerateOIDCState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	verifier, challenge, err := utils.GeneratePKCE()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), oidcRedirectURL(provider.Name()), state, nonce, challenge)
+	if err != nil {
+		log.Printf("Failed to build %s authorization URL: %v", provider.Name(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Login provider is unavailable"})
+		return
+	}
+
+	now := time.Now()
+	// Logins that were never completed are cleaned up here
+	if err := database.DB.Where("expires_at < ?", now).Delete(&models.OIDCLoginState{}).Error; err != nil {
+		log.Printf("Failed to remove expired social login states: %v", err)
+	}
+
+	record := models.OIDCLoginState{
+		Provider:     provider.Name(),
+		StateHash:    utils.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(time.Duration(config.GetOIDCStateExpiration()) * time.Minute),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": authURL,
+		"state":             state,
+	})
+}
+
+// CompleteOIDCLogin redeems the authorization code the provider sent back and
+// logs the user in. Unknown identities are linked to the account with the same
+// verified email address, or a new account is created for them while
+// registration is open.
+func CompleteOIDCLogin(c *gin.Context) {
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	provider, ok := findOIDCProvider(c)
+	if !ok {
+		return
+	}
+
+	// The state can only be used once, whoever deletes it owns the login
+	var state models.OIDCLoginState
+	result := database.DB.Where("state_hash = ? AND provider = ?", utils.HashToken(req.State), provider.Name()).First(&state)
+	if result.Error == nil {
+		result = database.DB.Delete(&state)
+	}
+	if result.Error != nil || result.RowsAffected == 0 || time.Now().After(state.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state", "code": "invalid_state"})
+		return
+	}
+
+	identity, err := provider.Identify(c.Request.Context(), oidcRedirectURL(provider.Name()), req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("Social login with %s failed: %v", provider.Name(), err)
+		if errors.Is(err, utils.ErrOIDCLogin) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Login with the provider failed", "code": "oidc_login_failed"})
+		} else {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Login provider is unavailable"})
+		}
+		return
+	}
+
+	user, err := userForIdentity(c, provider.Name(), identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errOIDCEmailNotVerified):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Your email address at the provider must be verified",
+				"code":  "provider_email_not_verified",
+			})
+		case errors.Is(err, errOIDCRegistrationClosed):
+			c.JSON(http.StatusForbidden, gin.H{"error": "No account is registered for this email address", "code": "registration_closed"})
+		case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, gorm.ErrDuplicatedKey):
+			// The linked account or the one holding the email address was deleted
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active", "code": "account_" + models.UserStatusDeleted})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		}
+		return
+	}
+
+	completeLogin(c, user, provider.Name())
+}
+
+// userForIdentity returns the user linked to a provider identity, linking or
+// creating the account by the identity's verified email on first login
+func userForIdentity(c *gin.Context, provider string, identity *utils.OIDCIdentity) (*models.User, error) {
+	now := time.Now()
+
+	var link models.UserIdentity
+	result := database.DB.Where("provider = ? AND subject = ?", provider, identity.Subject).First(&link)
+	if result.Error == nil {
+		var user models.User
+		if err := database.DB.First(&user, link.UserID).Error; err != nil {
+			return nil, err
+		}
+		if err := database.DB.Model(&link).Updates(map[string]interface{}{"email": identity.Email, "last_login_at": now}).Error; err != nil {
+			log.Printf("Failed to update identity %d: %v", link.ID, err)
+		}
+		return &user, nil
+	}
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, result.Error
+	}
+
+	// Only an email the provider verified may be matched to an account
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errOIDCEmailNotVerified
+	}
+
+	var user models.User
+	result = database.DB.Where("email = ?", identity.Email).First(&user)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, result.Error
+	}
+	created := errors.Is(result.Error, gorm.ErrRecordNotFound)
+
+	// Social logins cannot carry an invitation, so they only create accounts while registration is open
+	if created && config.GetRegistrationMode() != config.RegistrationOpen {
+		return nil, errOIDCRegistrationClosed
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if created {
+			user = models.User{
+				Name:            identity.GivenName,
+				Surname:         identity.FamilyName,
+				Email:           identity.Email,
+				Role:            models.RoleUser,
+				Status:          models.UserStatusActive,
+				ProfileImage:    identity.Picture,
+				ReferralSource:  provider,
+				EmailVerifiedAt: &now,
+			}
+			if user.Name == "" {
+				user.Name, _, _ = strings.Cut(identity.Email, "@")
+			}
+			if user.ProfileImage == "" {
+				user.ProfileImage = "/default-avatar.png"
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The provider confirmed the address, which is all a pending account was waiting for
+	if user.Status == models.UserStatusPending {
+		if err := claimPendingAccount(c, &user, "Email verified by "+provider+" login"); err != nil {
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// ListIdentities returns the social login identities linked to the current user
+func ListIdentities(c *gin.Context) {
+	// Get user ID from JWT token (set by AuthMiddleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var identities []models.UserIdentity
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve identities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"identities": identities,
+	})
+}
+
+// UnlinkIdentity removes a social login identity of the current user. The last
+// identity of an account without a password cannot be removed.
+func UnlinkIdentity(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	// Check if the ID is a valid number
+	identityID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity ID"})
+		return
+	}
+
+	var identity models.UserIdentity
+	result := database.DB.Where("id = ? AND user_id = ?", identityID, user.ID).First(&identity)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if user.Password == "" {
+		var count int64
+		if err := database.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if count <= 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Set a password before removing your last login provider",
+				"code":  "last_login_method",
+			})
+			return
+		}
+	}
+
+	// Unscoped so that the identity can be linked again later
+	if err := database.DB.Unscoped().Delete(&identity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink identity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": fmt.Sprintf("%s login removed", identity.Provider),
+	})
+}
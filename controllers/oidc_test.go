@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// mockOIDCProvider is a local OpenID Connect provider. Authorizations are
+// granted directly by the test instead of a login page.
+type mockOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu             sync.Mutex
+	authorizations map[string]mockAuthorization // by authorization code
+	tokenRequests  int
+}
+
+// mockAuthorization is a sign-in the provider will redeem for an ID token
+type mockAuthorization struct {
+	challenge   string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+const (
+	mockClientID     = "ambridge-test"
+	mockClientSecret = "test-secret"
+)
+
+// newMockOIDCProvider starts a mock provider and registers it as "mock"
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate provider key: %v", err)
+	}
+
+	mock := &mockOIDCProvider{key: key, authorizations: make(map[string]mockAuthorization)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", mock.discovery)
+	mux.HandleFunc("/jwks", mock.jwks)
+	mux.HandleFunc("/token", mock.token)
+	mock.server = httptest.NewServer(mux)
+	t.Cleanup(mock.server.Close)
+
+	utils.RegisterOIDCProvider(utils.NewOIDCProvider(config.OIDCProviderConfig{
+		Name:         "mock",
+		Type:         "oidc",
+		Issuer:       mock.server.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+	}))
+	return mock
+}
+
+func (m *mockOIDCProvider) discovery(w http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 m.server.URL,
+		"authorization_endpoint": m.server.URL + "/authorize",
+		"token_endpoint":         m.server.URL + "/token",
+		"jwks_uri":               m.server.URL + "/jwks",
+	})
+}
+
+func (m *mockOIDCProvider) jwks(w http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": "mock-key",
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+// token redeems an authorization code, checking the client and the PKCE verifier
+func (m *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.tokenRequests++
+	authorization, ok := m.authorizations[r.PostFormValue("code")]
+	delete(m.authorizations, r.PostFormValue("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	switch {
+	case !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != authorization.redirectURI:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	case r.PostFormValue("client_id") != mockClientID || r.PostFormValue("client_secret") != mockClientSecret:
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, authorization.claims)
+	token.Header["kid"] = "mock-key"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+// authorize signs a user in at the provider for the given authorization URL and
+// returns the authorization code. The claims are added to the ID token; a nonce
+// among them replaces the one of the request.
+func (m *mockOIDCProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Invalid authorization URL: %v", err)
+	}
+	query := u.Query()
+	if u.Path != "/authorize" || query.Get("response_type") != "code" || query.Get("client_id") != mockClientID {
+		t.Fatalf("Unexpected authorization URL %s", authURL)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("Authorization URL has no S256 code challenge: %s", authURL)
+	}
+	if query.Get("nonce") == "" || query.Get("state") == "" {
+		t.Fatalf("Authorization URL has no nonce or state: %s", authURL)
+	}
+
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss":   m.server.URL,
+		"aud":   mockClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+
+	code, err := utils.GenerateOIDCState()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	m.mu.Lock()
+	m.authorizations[code] = mockAuthorization{
+		challenge:   query.Get("code_challenge"),
+		redirectURI: query.Get("redirect_uri"),
+		claims:      idClaims,
+	}
+	m.mu.Unlock()
+	return code
+}
+
+// newOIDCRouter routes the social login endpoints
+func newOIDCRouter() *gin.Engine {
+	router := gin.New()
+	router.POST("/auth/oidc/:provider/authorize", StartOIDCLogin)
+	router.POST("/auth/oidc/:provider/callback", CompleteOIDCLogin)
+	return router
+}
+
+// startOIDCLogin starts a login with the mock provider and returns the
+// authorization URL and state
+func startOIDCLogin(t *testing.T, router *gin.Engine) (string, string) {
+	t.Helper()
+
+	w := performJSON(t, router, http.MethodPost, "/auth/oidc/mock/authorize", nil)
+	expectStatus(t, w, http.StatusOK)
+	body := decodeJSON(t, w)
+	authURL, _ := body["authorization_url"].(string)
+	state, _ := body["state"].(string)
+	if authURL == "" || state == "" {
+		t.Fatalf("Missing authorization URL or state: %v", body)
+	}
+	return authURL, state
+}
+
+func TestOIDCLoginWithPKCE(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	router := newOIDCRouter()
+
+	authURL, state := startOIDCLogin(t, router)
+	code := mock.authorize(t, authURL, jwt.MapClaims{
+		"sub":            "pkce-subject",
+		"email":          "oidc-new@example.com",
+		"email_verified": true,
+		"given_name":     "Ada",
+	})
+
+	w := performJSON(t, router, http.MethodPost, "/auth/oidc/mock/callback", OIDCCallbackRequest{Code: code, State: state})
+	expectStatus(t, w, http.StatusOK)
+	if token, _ := decodeJSON(t, w)["token"].(string); token == "" {
+		t.Fatalf("Login returned no token: %s", w.Body.String())
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", "oidc-new@example.com").First(&user).Error; err != nil {
+		t.Fatalf("Account was not created: %v", err)
+	}
+	if user.Status != models.UserStatusActive || user.Name != "Ada" {
+		t.Fatalf("Unexpected account %+v", user)
+	}
+	var identity models.UserIdentity
+	if err := database.DB.Where("provider = ? AND subject = ?", "mock", "pkce-subject").First(&identity).Error; err != nil {
+		t.Fatalf("Identity was not linked: %v", err)
+	}
+	if identity.UserID != user.ID {
+		t.Fatalf("Identity linked to user %d instead of %d", identity.UserID, user.ID)
+	}
+
+	// The state is used up by the first callback
+	w = performJSON(t, router, http.MethodPost, "/auth/oidc/mock/callback", OIDCCallbackRequest{Code: code, State: state})
+	expectCode(t, w, http.StatusBadRequest, "invalid_state")
+}
+
+func TestOIDCLoginRejectsStateMismatch(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	router := newOIDCRouter()
+
+	authURL, _ := startOIDCLogin(t, router)
+	code := mock.authorize(t, authURL, jwt.MapClaims{
+		"sub":            "state-subject",
+		"email":          "oidc-state@example.com",
+		"email_verified": true,
+	})
+
+	// A state this server never issued, e.g. from a forged callback
+	forged, err := utils.GenerateOIDCState()
+	if err != nil {
+		t.Fatalf("Failed to generate state: %v", err)
+	}
+	w := performJSON(t, router, http.MethodPost, "/auth/oidc/mock/callback", OIDCCallbackRequest{Code: code, State: forged})
+	expectCode(t, w, http.StatusBadRequest, "invalid_state")
+
+	if mock.tokenRequests != 0 {
+		t.Fatalf("Code was redeemed despite the state mismatch")
+	}
+}
+
+func TestOIDCLoginRejectsNonceMismatch(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	router := newOIDCRouter()
+
+	authURL, state := startOIDCLogin(t, router)
+	code := mock.authorize(t, authURL, jwt.MapClaims{
+		"sub":            "nonce-subject",
+		"email":          "oidc-nonce@example.com",
+		"email_verified": true,
+		"nonce":          "replayed-nonce",
+	})
+
+	w := performJSON(t, router, http.MethodPost, "/auth/oidc/mock/callback", OIDCCallbackRequest{Code: code, State: state})
+	expectCode(t, w, http.StatusUnauthorized, "oidc_login_failed")
+
+	var count int64
+	database.DB.Model(&models.User{}).Where("email = ?", "oidc-nonce@example.com").Count(&count)
+	if count != 0 {
+		t.Fatalf("Account was created from an ID token with the wrong nonce")
+	}
+}
+
+func TestOIDCLoginRefusesLinkingUnverifiedEmail(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	router := newOIDCRouter()
+	user := createTestUser(t, "oidc-existing@example.com")
+
+	authURL, state := startOIDCLogin(t, router)
+	code := mock.authorize(t, authURL, jwt.MapClaims{
+		"sub":            "unverified-subject",
+		"email":          "oidc-existing@example.com",
+		"email_verified": false,
+	})
+
+	w := performJSON(t, router, http.MethodPost, "/auth/oidc/mock/callback", OIDCCallbackRequest{Code: code, State: state})
+	expectCode(t, w, http.StatusForbidden, "provider_email_not_verified")
+
+	var count int64
+	database.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("Identity with an unverified email was linked to an existing account")
+	}
+}
+
+func TestOIDCLoginClaimsPendingAccount(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	router := newOIDCRouter()
+
+	// Someone registered the address with their own password but never verified it
+	hashedPassword, err := utils.HashPassword("Attacker-Password-1")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	user := createTestUser(t, "oidc-pending@example.com")
+	database.DB.Model(user).Updates(map[string]interface{}{
+		"status": models.UserStatusPending, "password": hashedPassword, "email_verified_at": nil,
+	})
+	session := models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour), LastUsedAt: time.Now()}
+	if err := database.DB.Create(&session).Error; err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	authURL, state := startOIDCLogin(t, router)
+	code := mock.authorize(t, authURL, jwt.MapClaims{
+		"sub":            "pending-subject",
+		"email":          "oidc-pending@example.com",
+		"email_verified": true,
+	})
+
+	w := performJSON(t, router, http.MethodPost, "/auth/oidc/mock/callback", OIDCCallbackRequest{Code: code, State: state})
+	expectStatus(t, w, http.StatusOK)
+
+	var claimed models.User
+	database.DB.First(&claimed, user.ID)
+	if claimed.Status != models.UserStatusActive || claimed.EmailVerifiedAt == nil {
+		t.Fatalf("Account was not activated: %+v", claimed)
+	}
+	if claimed.Password != "" {
+		t.Fatalf("The registrant's password still works after the owner claimed the account")
+	}
+	database.DB.First(&session, session.ID)
+	if session.RevokedAt == nil {
+		t.Fatalf("The registrant's session was not revoked")
+	}
+}
@@ -0,0 +1,446 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// PasskeyCredentialResponse is the authenticator response of a ceremony, with
+// binary values encoded as base64url. Registrations send the attestation
+// object and transports, logins the authenticator data, signature and user handle.
+type PasskeyCredentialResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+	AttestationObject string   `json:"attestationObject"`
+	Transports        []string `json:"transports"`
+	AuthenticatorData string   `json:"authenticatorData"`
+	Signature         string   `json:"signature"`
+	UserHandle        string   `json:"userHandle"`
+}
+
+// PasskeyCredential is the PublicKeyCredential returned by the browser, serialised as JSON
+type PasskeyCredential struct {
+	ID       string                    `json:"id" binding:"required"`
+	Type     string                    `json:"type" binding:"required"`
+	Response PasskeyCredentialResponse `json:"response" binding:"required"`
+}
+
+// RegisterPasskeyRequest represents the request body for finishing a passkey registration
+type RegisterPasskeyRequest struct {
+	Nickname   string            `json:"nickname" binding:"max=100"`
+	Credential PasskeyCredential `json:"credential" binding:"required"`
+}
+
+// PasskeyLoginRequest represents the request body for logging in with a passkey
+type PasskeyLoginRequest struct {
+	Credential PasskeyCredential `json:"credential" binding:"required"`
+}
+
+// passkeyTransports lists the transport hints that are stored
+var passkeyTransports = map[string]bool{
+	"usb": true, "nfc": true, "ble": true, "smart-card": true, "hybrid": true, "internal": true,
+}
+
+// passkeyView returns the public fields of a passkey
+func passkeyView(passkey *models.Passkey) gin.H {
+	return gin.H{
+		"id":            passkey.ID,
+		"nickname":      passkey.Nickname,
+		"credential_id": passkey.CredentialID,
+		"transports":    passkey.TransportList(),
+		"aaguid":        passkey.AAGUID,
+		"created_at":    passkey.CreatedAt,
+		"last_used_at":  passkey.LastUsedAt,
+	}
+}
+
+// createPasskeyChallenge stores a new challenge for a passkey ceremony
+func createPasskeyChallenge(userID uint, purpose string) (string, error) {
+	challenge, err := utils.GeneratePasskeyChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	// Ceremonies that were never completed are cleaned up here
+	if err := database.DB.Where("expires_at < ?", now).Delete(&models.PasskeyChallenge{}).Error; err != nil {
+		log.Printf("Failed to remove expired passkey challenges: %v", err)
+	}
+
+	record := models.PasskeyChallenge{
+		UserID:        userID,
+		Purpose:       purpose,
+		ChallengeHash: utils.HashToken(challenge),
+		ExpiresAt:     now.Add(time.Duration(config.GetWebAuthnChallengeExpiration()) * time.Minute),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// consumePasskeyChallenge uses up the challenge answered by the browser. A
+// challenge can only be used once, whoever deletes it owns the ceremony.
+func consumePasskeyChallenge(challenge, purpose string) (*models.PasskeyChallenge, bool) {
+	var record models.PasskeyChallenge
+	result := database.DB.Where("challenge_hash = ? AND purpose = ?", utils.HashToken(challenge), purpose).First(&record)
+	if result.Error == nil {
+		result = database.DB.Delete(&record)
+	}
+	if result.Error != nil || result.RowsAffected == 0 || time.Now().After(record.ExpiresAt) {
+		return nil, false
+	}
+	return &record, true
+}
+
+// respondInvalidPasskey rejects a ceremony that did not verify
+func respondInvalidPasskey(c *gin.Context, status int, err error) {
+	if err != nil {
+		log.Printf("Passkey ceremony rejected: %v", err)
+	}
+	c.JSON(status, gin.H{"error": "Passkey verification failed", "code": "invalid_passkey"})
+}
+
+// formatAAGUID formats an authenticator model ID as a UUID
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	h := hex.EncodeToString(aaguid)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// StartPasskeyRegistration returns the options for navigator.credentials.create()
+// to register a passkey for the current user
+func StartPasskeyRegistration(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	var passkeys []models.Passkey
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&passkeys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	challenge, err := createPasskeyChallenge(user.ID, models.PasskeyChallengeRegistration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	// Authenticators that already hold a passkey of the user are not registered twice
+	exclude := make([]gin.H, 0, len(passkeys))
+	for i := range passkeys {
+		exclude = append(exclude, gin.H{
+			"type":       "public-key",
+			"id":         passkeys[i].CredentialID,
+			"transports": passkeys[i].TransportList(),
+		})
+	}
+
+	params := make([]gin.H, 0, len(utils.PasskeyAlgorithms))
+	for _, alg := range utils.PasskeyAlgorithms {
+		params = append(params, gin.H{"type": "public-key", "alg": alg})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"publicKey": gin.H{
+			"challenge": challenge,
+			"rp": gin.H{
+				"id":   config.GetWebAuthnRPID(),
+				"name": config.GetWebAuthnRPName(),
+			},
+			"user": gin.H{
+				"id":          base64.RawURLEncoding.EncodeToString(utils.PasskeyUserHandle(user.ID)),
+				"name":        user.Email,
+				"displayName": strings.TrimSpace(user.Name + " " + user.Surname),
+			},
+			"pubKeyCredParams":   params,
+			"timeout":            config.GetWebAuthnChallengeExpiration() * 60 * 1000,
+			"attestation":        "none",
+			"excludeCredentials": exclude,
+			"authenticatorSelection": gin.H{
+				// Passkeys are discoverable so that login does not ask for the email first
+				"residentKey":        "required",
+				"requireResidentKey": true,
+				"userVerification":   "required",
+			},
+		},
+	})
+}
+
+// FinishPasskeyRegistration verifies the credential created by the browser
+// and stores it as a passkey of the current user
+func FinishPasskeyRegistration(c *gin.Context) {
+	var req RegisterPasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	credential := req.Credential
+	clientDataJSON, err := utils.DecodePasskeyBase64(credential.Response.ClientDataJSON)
+	if err != nil || credential.Type != "public-key" {
+		respondInvalidPasskey(c, http.StatusBadRequest, err)
+		return
+	}
+	attestationObject, err := utils.DecodePasskeyBase64(credential.Response.AttestationObject)
+	if err != nil || len(attestationObject) == 0 {
+		respondInvalidPasskey(c, http.StatusBadRequest, err)
+		return
+	}
+
+	clientData, err := utils.ParsePasskeyClientData(clientDataJSON, utils.PasskeyCeremonyCreate)
+	if err != nil {
+		respondInvalidPasskey(c, http.StatusBadRequest, err)
+		return
+	}
+	challenge, ok := consumePasskeyChallenge(clientData.Challenge, models.PasskeyChallengeRegistration)
+	if !ok || challenge.UserID != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired challenge", "code": "invalid_challenge"})
+		return
+	}
+
+	created, err := utils.VerifyPasskeyRegistration(attestationObject)
+	if err != nil {
+		respondInvalidPasskey(c, http.StatusBadRequest, err)
+		return
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(created.ID)
+	if credentialID != strings.TrimRight(credential.ID, "=") || len(credentialID) > 255 {
+		respondInvalidPasskey(c, http.StatusBadRequest, errors.New("credential ID does not match the authenticator data"))
+		return
+	}
+
+	transports := make([]string, 0, len(credential.Response.Transports))
+	for _, transport := range credential.Response.Transports {
+		if passkeyTransports[transport] {
+			transports = append(transports, transport)
+		}
+	}
+
+	nickname := strings.TrimSpace(req.Nickname)
+	if nickname == "" {
+		nickname = "Passkey"
+	}
+
+	passkey := models.Passkey{
+		UserID:       user.ID,
+		CredentialID: credentialID,
+		PublicKey:    created.PublicKey,
+		Algorithm:    created.Algorithm,
+		SignCount:    created.SignCount,
+		Transports:   strings.Join(transports, ","),
+		AAGUID:       formatAAGUID(created.AAGUID),
+		Nickname:     nickname,
+	}
+	if err := database.DB.Create(&passkey).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This passkey is already registered", "code": "passkey_already_registered"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Passkey registered successfully",
+		"passkey": passkeyView(&passkey),
+	})
+}
+
+// StartPasskeyLogin returns the options for navigator.credentials.get(). No
+// credentials are listed, the authenticator offers the user's passkeys itself.
+func StartPasskeyLogin(c *gin.Context) {
+	challenge, err := createPasskeyChallenge(0, models.PasskeyChallengeLogin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"publicKey": gin.H{
+			"challenge":        challenge,
+			"rpId":             config.GetWebAuthnRPID(),
+			"timeout":          config.GetWebAuthnChallengeExpiration() * 60 * 1000,
+			"userVerification": "required",
+			"allowCredentials": []gin.H{},
+		},
+	})
+}
+
+// FinishPasskeyLogin verifies the signature of a passkey and logs its owner in
+func FinishPasskeyLogin(c *gin.Context) {
+	var req PasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential := req.Credential
+	clientDataJSON, err := utils.DecodePasskeyBase64(credential.Response.ClientDataJSON)
+	if err != nil || credential.Type != "public-key" {
+		respondInvalidPasskey(c, http.StatusUnauthorized, err)
+		return
+	}
+	authenticatorData, err := utils.DecodePasskeyBase64(credential.Response.AuthenticatorData)
+	if err != nil {
+		respondInvalidPasskey(c, http.StatusUnauthorized, err)
+		return
+	}
+	signature, err := utils.DecodePasskeyBase64(credential.Response.Signature)
+	if err != nil || len(signature) == 0 {
+		respondInvalidPasskey(c, http.StatusUnauthorized, err)
+		return
+	}
+	userHandle, err := utils.DecodePasskeyBase64(credential.Response.UserHandle)
+	if err != nil {
+		respondInvalidPasskey(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	clientData, err := utils.ParsePasskeyClientData(clientDataJSON, utils.PasskeyCeremonyGet)
+	if err != nil {
+		respondInvalidPasskey(c, http.StatusUnauthorized, err)
+		return
+	}
+	if _, ok := consumePasskeyChallenge(clientData.Challenge, models.PasskeyChallengeLogin); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired challenge", "code": "invalid_challenge"})
+		return
+	}
+
+	var passkey models.Passkey
+	if err := database.DB.Where("credential_id = ?", strings.TrimRight(credential.ID, "=")).First(&passkey).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		respondInvalidPasskey(c, http.StatusUnauthorized, errors.New("unknown credential"))
+		return
+	}
+
+	// Discoverable credentials name their user, which must be the passkey's owner
+	if len(userHandle) > 0 && string(userHandle) != string(utils.PasskeyUserHandle(passkey.UserID)) {
+		respondInvalidPasskey(c, http.StatusUnauthorized, fmt.Errorf("user handle does not match passkey %d", passkey.ID))
+		return
+	}
+
+	signCount, err := utils.VerifyPasskeyAssertion(passkey.PublicKey, clientDataJSON, authenticatorData, signature)
+	if err != nil {
+		respondInvalidPasskey(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	// A counter that does not increase points to a cloned authenticator;
+	// authenticators that do not count always report 0
+	if (signCount != 0 || passkey.SignCount != 0) && signCount <= passkey.SignCount {
+		respondInvalidPasskey(c, http.StatusUnauthorized,
+			fmt.Errorf("sign count of passkey %d went from %d to %d", passkey.ID, passkey.SignCount, signCount))
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&passkey).Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": now}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, passkey.UserID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		respondInvalidPasskey(c, http.StatusUnauthorized, fmt.Errorf("owner of passkey %d not found", passkey.ID))
+		return
+	}
+
+	completeLogin(c, &user, "passkey")
+}
+
+// ListPasskeys returns the passkeys of the current user
+func ListPasskeys(c *gin.Context) {
+	// Get user ID from JWT token (set by AuthMiddleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var passkeys []models.Passkey
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&passkeys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve passkeys"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(passkeys))
+	for i := range passkeys {
+		items = append(items, passkeyView(&passkeys[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"passkeys": items,
+	})
+}
+
+// DeletePasskey removes a passkey of the current user
+func DeletePasskey(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Check if the ID is a valid number
+	passkeyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	var passkey models.Passkey
+	result := database.DB.Where("id = ? AND user_id = ?", passkeyID, userID).First(&passkey)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	// Unscoped so that the authenticator can be registered again later
+	if err := database.DB.Unscoped().Delete(&passkey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove passkey"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Passkey removed successfully",
+	})
+}
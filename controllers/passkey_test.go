@@ -0,0 +1,383 @@
+package controllers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// testOrigin is the default WEBAUTHN_ORIGINS entry
+const testOrigin = "http://localhost:3000"
+
+// softAuthenticator is a software passkey authenticator holding a single
+// ES256 credential
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+	presenceOnly bool // leave out the user verified flag
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate credential key: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("Failed to generate credential ID: %v", err)
+	}
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+// cborHead encodes the initial bytes of a CBOR item
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	default:
+		head := []byte{major<<5 | 25, 0, 0}
+		binary.BigEndian.PutUint16(head[1:], uint16(arg))
+		return head
+	}
+}
+
+func cborInt(value int64) []byte {
+	if value < 0 {
+		return cborHead(1, uint64(-1-value))
+	}
+	return cborHead(0, uint64(value))
+}
+
+func cborBytes(value []byte) []byte {
+	return append(cborHead(2, uint64(len(value))), value...)
+}
+
+func cborText(value string) []byte {
+	return append(cborHead(3, uint64(len(value))), value...)
+}
+
+// cborMap encodes a map from its already encoded keys and values
+func cborMap(entries ...[]byte) []byte {
+	encoded := cborHead(5, uint64(len(entries)/2))
+	for _, entry := range entries {
+		encoded = append(encoded, entry...)
+	}
+	return encoded
+}
+
+// coseKey returns the COSE encoding of the credential's public key
+func (a *softAuthenticator) coseKey() []byte {
+	x := a.key.PublicKey.X.FillBytes(make([]byte, 32))
+	y := a.key.PublicKey.Y.FillBytes(make([]byte, 32))
+	return cborMap(
+		cborInt(1), cborInt(2), // kty: EC2
+		cborInt(3), cborInt(utils.COSEAlgorithmES256),
+		cborInt(-1), cborInt(1), // crv: P-256
+		cborInt(-2), cborBytes(x),
+		cborInt(-3), cborBytes(y),
+	)
+}
+
+// authenticatorData builds the authenticator data for the default relying
+// party, with the attested credential when registering
+func (a *softAuthenticator) authenticatorData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(config.GetWebAuthnRPID()))
+	data := append([]byte(nil), rpIDHash[:]...)
+
+	flags := byte(0x01 | 0x04) // user present and verified
+	if a.presenceOnly {
+		flags &^= 0x04
+	}
+	if attested {
+		flags |= 0x40
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID of a "none" attestation
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+// clientData returns the client data JSON the browser would send
+func clientData(t *testing.T, ceremony, challenge, origin string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(utils.PasskeyClientData{Type: ceremony, Challenge: challenge, Origin: origin})
+	if err != nil {
+		t.Fatalf("Failed to encode client data: %v", err)
+	}
+	return data
+}
+
+// create answers a registration challenge with a "none" attestation
+func (a *softAuthenticator) create(t *testing.T, challenge, origin string) PasskeyCredential {
+	t.Helper()
+
+	attestationObject := cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authenticatorData(true)),
+	)
+	return a.credential(PasskeyCredentialResponse{
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientData(t, utils.PasskeyCeremonyCreate, challenge, origin)),
+		AttestationObject: base64.RawURLEncoding.EncodeToString(attestationObject),
+		Transports:        []string{"internal"},
+	})
+}
+
+// get answers a login challenge, counting the signature
+func (a *softAuthenticator) get(t *testing.T, challenge, origin string, userID uint) PasskeyCredential {
+	t.Helper()
+
+	a.signCount++
+	authData := a.authenticatorData(false)
+	clientDataJSON := clientData(t, utils.PasskeyCeremonyGet, challenge, origin)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign assertion: %v", err)
+	}
+
+	return a.credential(PasskeyCredentialResponse{
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+		AuthenticatorData: base64.RawURLEncoding.EncodeToString(authData),
+		Signature:         base64.RawURLEncoding.EncodeToString(signature),
+		UserHandle:        base64.RawURLEncoding.EncodeToString(utils.PasskeyUserHandle(userID)),
+	})
+}
+
+func (a *softAuthenticator) credential(response PasskeyCredentialResponse) PasskeyCredential {
+	return PasskeyCredential{
+		ID:       base64.RawURLEncoding.EncodeToString(a.credentialID),
+		Type:     "public-key",
+		Response: response,
+	}
+}
+
+// newPasskeyRouter routes the passkey endpoints, with the registration
+// endpoints acting for the given user
+func newPasskeyRouter(userID uint) *gin.Engine {
+	router := gin.New()
+	router.POST("/auth/passkeys/login/options", StartPasskeyLogin)
+	router.POST("/auth/passkeys/login", FinishPasskeyLogin)
+
+	authRequired := router.Group("/auth", func(c *gin.Context) { c.Set("user_id", userID) })
+	authRequired.POST("/passkeys/register/options", StartPasskeyRegistration)
+	authRequired.POST("/passkeys/register", FinishPasskeyRegistration)
+	return router
+}
+
+// passkeyChallenge requests the options of a ceremony and returns its challenge
+func passkeyChallenge(t *testing.T, router *gin.Engine, path string) string {
+	t.Helper()
+
+	w := performJSON(t, router, http.MethodPost, path, nil)
+	expectStatus(t, w, http.StatusOK)
+	options, _ := decodeJSON(t, w)["publicKey"].(map[string]interface{})
+	challenge, _ := options["challenge"].(string)
+	if challenge == "" {
+		t.Fatalf("Options contain no challenge: %s", w.Body.String())
+	}
+	return challenge
+}
+
+// registerPasskey registers the authenticator's credential for the user
+func registerPasskey(t *testing.T, router *gin.Engine, authenticator *softAuthenticator) {
+	t.Helper()
+
+	challenge := passkeyChallenge(t, router, "/auth/passkeys/register/options")
+	w := performJSON(t, router, http.MethodPost, "/auth/passkeys/register",
+		RegisterPasskeyRequest{Nickname: "Laptop", Credential: authenticator.create(t, challenge, testOrigin)})
+	expectStatus(t, w, http.StatusCreated)
+}
+
+// loginWithPasskey logs in with the authenticator's credential
+func loginWithPasskey(t *testing.T, router *gin.Engine, authenticator *softAuthenticator, userID uint) *httptest.ResponseRecorder {
+	t.Helper()
+
+	challenge := passkeyChallenge(t, router, "/auth/passkeys/login/options")
+	return performJSON(t, router, http.MethodPost, "/auth/passkeys/login",
+		PasskeyLoginRequest{Credential: authenticator.get(t, challenge, testOrigin, userID)})
+}
+
+// storedPasskey loads the passkey of the authenticator's credential
+func storedPasskey(t *testing.T, authenticator *softAuthenticator) models.Passkey {
+	t.Helper()
+
+	var passkey models.Passkey
+	credentialID := base64.RawURLEncoding.EncodeToString(authenticator.credentialID)
+	if err := database.DB.Where("credential_id = ?", credentialID).First(&passkey).Error; err != nil {
+		t.Fatalf("Passkey was not stored: %v", err)
+	}
+	return passkey
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	user := createTestUser(t, "passkey-login@example.com")
+	router := newPasskeyRouter(user.ID)
+	authenticator := newSoftAuthenticator(t)
+
+	registerPasskey(t, router, authenticator)
+	passkey := storedPasskey(t, authenticator)
+	if passkey.UserID != user.ID || passkey.Algorithm != utils.COSEAlgorithmES256 || passkey.Transports != "internal" {
+		t.Fatalf("Unexpected passkey %+v", passkey)
+	}
+
+	w := loginWithPasskey(t, router, authenticator, user.ID)
+	expectStatus(t, w, http.StatusOK)
+	if token, _ := decodeJSON(t, w)["token"].(string); token == "" {
+		t.Fatalf("Login returned no token: %s", w.Body.String())
+	}
+
+	passkey = storedPasskey(t, authenticator)
+	if passkey.SignCount != authenticator.signCount || passkey.LastUsedAt == nil {
+		t.Fatalf("Login did not update the passkey: %+v", passkey)
+	}
+}
+
+func TestPasskeyLoginRejectsSignCountRegression(t *testing.T) {
+	user := createTestUser(t, "passkey-clone@example.com")
+	router := newPasskeyRouter(user.ID)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, router, authenticator)
+
+	authenticator.signCount = 10
+	expectStatus(t, loginWithPasskey(t, router, authenticator, user.ID), http.StatusOK)
+
+	// A clone of the authenticator still counts from an older state
+	authenticator.signCount = 5
+	w := loginWithPasskey(t, router, authenticator, user.ID)
+	expectCode(t, w, http.StatusUnauthorized, "invalid_passkey")
+
+	if passkey := storedPasskey(t, authenticator); passkey.SignCount != 11 {
+		t.Fatalf("Sign count changed to %d after a rejected login", passkey.SignCount)
+	}
+}
+
+func TestPasskeyRejectsWrongOrigin(t *testing.T) {
+	user := createTestUser(t, "passkey-origin@example.com")
+	router := newPasskeyRouter(user.ID)
+	authenticator := newSoftAuthenticator(t)
+
+	challenge := passkeyChallenge(t, router, "/auth/passkeys/register/options")
+	w := performJSON(t, router, http.MethodPost, "/auth/passkeys/register",
+		RegisterPasskeyRequest{Credential: authenticator.create(t, challenge, "https://evil.example")})
+	expectCode(t, w, http.StatusBadRequest, "invalid_passkey")
+
+	registerPasskey(t, router, authenticator)
+	challenge = passkeyChallenge(t, router, "/auth/passkeys/login/options")
+	w = performJSON(t, router, http.MethodPost, "/auth/passkeys/login",
+		PasskeyLoginRequest{Credential: authenticator.get(t, challenge, "https://evil.example", user.ID)})
+	expectCode(t, w, http.StatusUnauthorized, "invalid_passkey")
+}
+
+func TestPasskeyRequiresUserVerification(t *testing.T) {
+	user := createTestUser(t, "passkey-presence@example.com")
+	router := newPasskeyRouter(user.ID)
+	authenticator := newSoftAuthenticator(t)
+
+	authenticator.presenceOnly = true
+	challenge := passkeyChallenge(t, router, "/auth/passkeys/register/options")
+	w := performJSON(t, router, http.MethodPost, "/auth/passkeys/register",
+		RegisterPasskeyRequest{Credential: authenticator.create(t, challenge, testOrigin)})
+	expectCode(t, w, http.StatusBadRequest, "invalid_passkey")
+
+	// A passkey registered with verification cannot log in without it
+	authenticator.presenceOnly = false
+	registerPasskey(t, router, authenticator)
+	authenticator.presenceOnly = true
+	w = loginWithPasskey(t, router, authenticator, user.ID)
+	expectCode(t, w, http.StatusUnauthorized, "invalid_passkey")
+}
+
+func TestPasskeyRejectsWrongChallenge(t *testing.T) {
+	user := createTestUser(t, "passkey-challenge@example.com")
+	router := newPasskeyRouter(user.ID)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, router, authenticator)
+
+	// A challenge the server never issued
+	forged, err := utils.GeneratePasskeyChallenge()
+	if err != nil {
+		t.Fatalf("Failed to generate challenge: %v", err)
+	}
+	w := performJSON(t, router, http.MethodPost, "/auth/passkeys/login",
+		PasskeyLoginRequest{Credential: authenticator.get(t, forged, testOrigin, user.ID)})
+	expectCode(t, w, http.StatusBadRequest, "invalid_challenge")
+
+	// A registration challenge cannot be used to log in
+	challenge := passkeyChallenge(t, router, "/auth/passkeys/register/options")
+	w = performJSON(t, router, http.MethodPost, "/auth/passkeys/login",
+		PasskeyLoginRequest{Credential: authenticator.get(t, challenge, testOrigin, user.ID)})
+	expectCode(t, w, http.StatusBadRequest, "invalid_challenge")
+
+	// Nor can a login challenge be answered twice
+	challenge = passkeyChallenge(t, router, "/auth/passkeys/login/options")
+	expectStatus(t, performJSON(t, router, http.MethodPost, "/auth/passkeys/login",
+		PasskeyLoginRequest{Credential: authenticator.get(t, challenge, testOrigin, user.ID)}), http.StatusOK)
+	w = performJSON(t, router, http.MethodPost, "/auth/passkeys/login",
+		PasskeyLoginRequest{Credential: authenticator.get(t, challenge, testOrigin, user.ID)})
+	expectCode(t, w, http.StatusBadRequest, "invalid_challenge")
+}
+
+func TestPasskeyRegistrationRejectsMalformedCBOR(t *testing.T) {
+	user := createTestUser(t, "passkey-cbor@example.com")
+	router := newPasskeyRouter(user.ID)
+	authenticator := newSoftAuthenticator(t)
+
+	valid := authenticator.create(t, "", testOrigin).Response.AttestationObject
+	attestationObject, err := utils.DecodePasskeyBase64(valid)
+	if err != nil {
+		t.Fatalf("Failed to decode attestation object: %v", err)
+	}
+
+	tests := map[string][]byte{
+		"truncated":          attestationObject[:len(attestationObject)/2],
+		"indefinite length":  {0xbf, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e', 0xff},
+		"not a map":          cborBytes([]byte("authData")),
+		"authData not bytes": cborMap(cborText("fmt"), cborText("none"), cborText("authData"), cborText("text")),
+	}
+	for name, object := range tests {
+		t.Run(name, func(t *testing.T) {
+			challenge := passkeyChallenge(t, router, "/auth/passkeys/register/options")
+			credential := authenticator.create(t, challenge, testOrigin)
+			credential.Response.AttestationObject = base64.RawURLEncoding.EncodeToString(object)
+
+			w := performJSON(t, router, http.MethodPost, "/auth/passkeys/register",
+				RegisterPasskeyRequest{Credential: credential})
+			expectCode(t, w, http.StatusBadRequest, "invalid_passkey")
+		})
+	}
+
+	var count int64
+	database.DB.Model(&models.Passkey{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("Passkey was stored from a malformed attestation object")
+	}
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/mailer"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// ForgotPasswordRequest represents the request body for requesting a password reset
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the request body for resetting a password
+type ResetPasswordRequest struct {
+	Email       string `json:"email" binding:"required,email"`
+	Code        string `json:"code" binding:"required,len=6,numeric"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+var (
+	passwordResetLimiter     *utils.RateLimiter
+	passwordResetLimiterOnce sync.Once
+)
+
+// resetLimiter returns the per-email rate limiter for password reset requests
+func resetLimiter() *utils.RateLimiter {
+	passwordResetLimiterOnce.Do(func() {
+		passwordResetLimiter = utils.NewRateLimiter(config.GetPasswordResetRateLimit(), time.Hour)
+	})
+	return passwordResetLimiter
+}
+
+// sendPasswordResetEmail issues a password reset code and mails it to the user
+func sendPasswordResetEmail(user *models.User) error {
+	code, err := issueVerificationCode(user.ID, models.VerificationPurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Ambridge password",
+		Body: fmt.Sprintf("Hi %s,\n\nYour Ambridge password reset code is: %s\n\nThe code expires in %d minutes. "+
+			"If you did not request a password reset you can ignore this email.",
+			user.Name, code, config.GetOTPExpiration()),
+	})
+}
+
+// checkPasswordPolicy validates a new password against the password policy and
+// writes a response listing every broken rule when it is rejected
+func checkPasswordPolicy(c *gin.Context, password string, personalInfo ...string) bool {
+	violations := utils.ValidatePassword(password, personalInfo...)
+	if len(violations) == 0 {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Password does not meet the requirements",
+		"code":       "weak_password",
+		"violations": violations,
+	})
+	return false
+}
+
+// ForgotPassword emails a password reset code to the user.
+// The response is the same whether or not the email is registered.
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email := strings.ToLower(req.Email)
+
+	// Rate limit per email address, registered or not
+	if !resetLimiter().Allow(email) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many password reset requests, please try again later", "code": "too_many_requests"})
+		return
+	}
+
+	// Look up and email the user in the background so the response time does not
+	// reveal whether the account exists
+	go func() {
+		var user models.User
+		if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Failed to look up user for password reset: %v", err)
+			}
+			return
+		}
+
+		if err := sendPasswordResetEmail(&user); err != nil && !errors.Is(err, errCodeThrottled) {
+			log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a password reset code has been sent"})
+}
+
+// ResetPassword sets a new password using the code sent by ForgotPassword
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Find user by email
+	var user models.User
+	result := database.DB.Where("email = ?", strings.ToLower(req.Email)).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			respondCodeError(c, errCodeInvalid)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	// The code is checked first, so that the policy violations, which depend on the
+	// account's email and name, are only shown to the owner of the account
+	vc, err := checkVerificationCode(user.ID, models.VerificationPurposePasswordReset, req.Code)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	// A rejected password leaves the code unused so the user can try another one
+	if !checkPasswordPolicy(c, req.NewPassword, user.Email, user.Name, user.Surname) {
+		return
+	}
+
+	if err := markVerificationCodeConsumed(vc); err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	// Hash password
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// Store the new password
+	updates := map[string]interface{}{
+		"password": hashedPassword,
+	}
+	// The code was delivered to the user's inbox, which also proves ownership of the email
+	if !user.IsEmailVerified() {
+		updates["email_verified_at"] = time.Now()
+	}
+
+	if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Proving the address is all a pending account was waiting for
+	if user.Status == models.UserStatusPending {
+		if err := changeUserStatus(c, &user, models.UserStatusActive, "Email verified by password reset"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate account"})
+			return
+		}
+	}
+
+	// Log out every device of the user and invalidate their access tokens
+	if err := revokeUserSessions(user.ID, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	if err := utils.RevokeUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/mailer"
+	"ambridge-backend/models"
+)
+
+// DeleteAccountRequest represents the request body for deleting the current user's account
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"` // TOTP or recovery code, required when 2FA is enabled
+}
+
+// exportSections lists the files of a ZIP export in the order they are written
+var exportSections = []string{"profile", "sessions", "api_keys", "identities", "passkeys", "projects", "auth_events", "status_history"}
+
+// DeleteAccount deletes the current user's account. The account can be restored
+// by an admin during the grace period, after which its personal data is purged.
+func DeleteAccount(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !checkCurrentPassword(c, user, req.Password) {
+		return
+	}
+
+	if user.IsTOTPEnabled() {
+		valid, err := verifySecondFactor(user, req.Code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code", "code": "invalid_code"})
+			return
+		}
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(user).Update("deletion_requested_at", now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if err := changeUserStatus(c, user, models.UserStatusDeleted, "Deleted by the user"); err != nil {
+		if errors.Is(err, errInvalidStatusTransition) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Account cannot be deleted in its current state", "code": "invalid_status_transition"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		}
+		return
+	}
+
+	purgeAfter := now.AddDate(0, 0, config.GetAccountDeletionGracePeriod())
+	err := mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Ambridge account was deleted",
+		Body: fmt.Sprintf("Hi %s,\n\nYour Ambridge account was deleted and you were signed out everywhere. "+
+			"Your personal data will be permanently erased on %s. "+
+			"If you did not do this or change your mind, please contact support before then.",
+			user.Name, purgeAfter.Format("2006-01-02")),
+	})
+	if err != nil {
+		log.Printf("Failed to send account deletion notice to user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Account deleted successfully",
+		"purge_after": purgeAfter,
+	})
+}
+
+// ExportAccount returns everything stored about the current user, either as a
+// single JSON document or as a ZIP archive with one JSON file per section
+func ExportAccount(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json or zip"})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	data, err := collectAccountData(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account data"})
+		return
+	}
+
+	filename := fmt.Sprintf("ambridge-export-%d-%s", user.ID, time.Now().Format("20060102"))
+	if format == "json" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		c.JSON(http.StatusOK, data)
+		return
+	}
+
+	archive, err := zipAccountData(data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account data"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// collectAccountData gathers the user's profile and every record linked to them.
+// Secrets such as password hashes and token hashes are left out by the models' JSON tags.
+func collectAccountData(user *models.User) (gin.H, error) {
+	var sessions []models.Session
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	var keys []models.APIKey
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	apiKeys := make([]gin.H, 0, len(keys))
+	for i := range keys {
+		apiKeys = append(apiKeys, apiKeyView(&keys[i]))
+	}
+
+	var identities []models.UserIdentity
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+
+	var storedPasskeys []models.Passkey
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&storedPasskeys).Error; err != nil {
+		return nil, err
+	}
+	passkeys := make([]gin.H, 0, len(storedPasskeys))
+	for i := range storedPasskeys {
+		passkeys = append(passkeys, passkeyView(&storedPasskeys[i]))
+	}
+
+	var projects []models.Project
+	if err := database.DB.Where("owner_id = ?", user.ID).Order("created_at").Find(&projects).Error; err != nil {
+		return nil, err
+	}
+
+	var events []models.AuthEvent
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	var changes []models.UserStatusChange
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&changes).Error; err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"exported_at":    time.Now(),
+		"profile":        user,
+		"sessions":       sessions,
+		"api_keys":       apiKeys,
+		"identities":     identities,
+		"passkeys":       passkeys,
+		"projects":       projects,
+		"auth_events":    events,
+		"status_history": changes,
+	}, nil
+}
+
+// zipAccountData writes each exported section to its own JSON file in a ZIP archive
+func zipAccountData(data gin.H) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	for _, section := range exportSections {
+		file, err := archive.Create(section + ".json")
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data[section]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
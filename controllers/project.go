@@ -5,9 +5,11 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
 
 	"ambridge-backend/database"
 	"ambridge-backend/models"
+	"ambridge-backend/utils"
 )
 
 // ProjectRequest represents the request body for project operations
@@ -29,8 +31,43 @@ type ProjectRequest struct {
 	InstaLink    string `json:"insta_link"`
 }
 
+// canEditProject reports whether the current user owns the project or holds the
+// projects:write permission, which allows editing any project
+func canEditProject(c *gin.Context, project *models.Project) (bool, error) {
+	userID, _ := c.Get("user_id")
+	if project.OwnerID != nil && userID == *project.OwnerID {
+		return true, nil
+	}
+
+	role, _ := c.Get("role")
+	return utils.HasPermission(role.(string), models.PermissionProjectsWrite)
+}
+
+// authorizeProjectWrite writes the error response when the current user may not edit the project
+func authorizeProjectWrite(c *gin.Context, project *models.Project) bool {
+	allowed, err := canEditProject(c, project)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the project owner or an admin can modify this project"})
+		return false
+	}
+	return true
+}
+
 // CreateProject handles the creation of a new project
+// The current user becomes the owner of the project
 func CreateProject(c *gin.Context) {
+	// Get user ID from JWT token (set by AuthMiddleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	ownerID := userID.(uint)
+
 	var request ProjectRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -53,6 +90,7 @@ func CreateProject(c *gin.Context) {
 		YoutubeLink:  request.YoutubeLink,
 		GithubLink:   request.GithubLink,
 		InstaLink:    request.InstaLink,
+		OwnerID:      &ownerID,
 	}
 
 	if result := database.DB.Create(&project); result.Error != nil {
@@ -60,6 +98,9 @@ func CreateProject(c *gin.Context) {
 		return
 	}
 
+	// Include the owner in the response
+	database.DB.Preload("Owner").First(&project, project.ID)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"status":  "success",
 		"message": "Project created successfully",
@@ -68,9 +109,31 @@ func CreateProject(c *gin.Context) {
 }
 
 // GetAllProjects returns all projects
+// ?owner=me lists the current user's projects, ?owner={id} the projects of another user
 func GetAllProjects(c *gin.Context) {
+	query := database.DB.Preload("Owner")
+
+	switch owner := c.Query("owner"); owner {
+	case "":
+	case "me":
+		// Set by OptionalAuthMiddleware when a token was sent
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication is required for owner=me"})
+			return
+		}
+		query = query.Where("owner_id = ?", userID)
+	default:
+		ownerID, err := strconv.ParseUint(owner, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid owner"})
+			return
+		}
+		query = query.Where("owner_id = ?", ownerID)
+	}
+
 	var projects []models.Project
-	if result := database.DB.Find(&projects); result.Error != nil {
+	if result := query.Find(&projects); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve projects"})
 		return
 	}
@@ -86,7 +149,7 @@ func GetProject(c *gin.Context) {
 	id := c.Param("id")
 	var project models.Project
 
-	if result := database.DB.First(&project, id); result.Error != nil {
+	if result := database.DB.Preload("Owner").First(&project, id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
@@ -98,6 +161,7 @@ func GetProject(c *gin.Context) {
 }
 
 // UpdateProject updates a specific project
+// Only the owner or users with the projects:write permission can update it
 func UpdateProject(c *gin.Context) {
 	id := c.Param("id")
 	var project models.Project
@@ -108,6 +172,10 @@ func UpdateProject(c *gin.Context) {
 		return
 	}
 
+	if !authorizeProjectWrite(c, &project) {
+		return
+	}
+
 	// Parse request
 	var request ProjectRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -132,12 +200,15 @@ func UpdateProject(c *gin.Context) {
 	project.GithubLink = request.GithubLink
 	project.InstaLink = request.InstaLink
 
-	// Save changes
-	if result := database.DB.Save(&project); result.Error != nil {
+	// Save changes, never the owner's user row
+	if result := database.DB.Omit(clause.Associations).Save(&project); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
 		return
 	}
 
+	// Include the owner in the response
+	database.DB.Preload("Owner").First(&project, project.ID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "Project updated successfully",
@@ -146,6 +217,7 @@ func UpdateProject(c *gin.Context) {
 }
 
 // DeleteProject removes a project from the database
+// Only the owner or users with the projects:write permission can delete it
 func DeleteProject(c *gin.Context) {
 	id := c.Param("id")
 
@@ -156,16 +228,20 @@ func DeleteProject(c *gin.Context) {
 		return
 	}
 
-	// Delete the project
-	result := database.DB.Delete(&models.Project{}, projectID)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+	// Check if project exists
+	var project models.Project
+	if result := database.DB.First(&project, projectID); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
 
-	// Check if anything was deleted
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	if !authorizeProjectWrite(c, &project) {
+		return
+	}
+
+	// Delete the project
+	if result := database.DB.Delete(&project); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 		return
 	}
 
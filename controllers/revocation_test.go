@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+	"ambridge-backend/middleware"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// newRevocationRouter serves a protected endpoint that reports success
+func newRevocationRouter() *gin.Engine {
+	router := gin.New()
+	router.GET("/protected", middleware.AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+// getWithToken sends a GET request authenticated with a bearer token
+func getWithToken(router *gin.Engine, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// generateTestJWT issues an access token without a session for the user
+func generateTestJWT(t *testing.T, user *models.User) string {
+	t.Helper()
+
+	token, err := utils.GenerateJWT(user.ID, user.Role, 0)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	return token
+}
+
+func TestRevokedTokenIsRejected(t *testing.T) {
+	user := createTestUser(t, "revoke-token@example.com")
+	router := newRevocationRouter()
+	token := generateTestJWT(t, user)
+
+	expectStatus(t, getWithToken(router, "/protected", token), http.StatusOK)
+
+	claims, err := utils.VerifyJWT(token)
+	if err != nil {
+		t.Fatalf("Failed to verify token: %v", err)
+	}
+	if err := utils.RevokeToken(claims.ID, user.ID, claims.ExpiresAt.Time); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	expectCode(t, getWithToken(router, "/protected", token), http.StatusUnauthorized, "token_revoked")
+}
+
+func TestRevokeUserTokensCutoff(t *testing.T) {
+	user := createTestUser(t, "revoke-user@example.com")
+	router := newRevocationRouter()
+
+	// Several rounds, so that revocations land in the same second as the earlier token
+	for i := 0; i < 5; i++ {
+		before := generateTestJWT(t, user)
+		if err := utils.RevokeUserTokens(user.ID); err != nil {
+			t.Fatalf("Failed to revoke tokens: %v", err)
+		}
+		after := generateTestJWT(t, user)
+
+		expectCode(t, getWithToken(router, "/protected", before), http.StatusUnauthorized, "token_revoked")
+		expectStatus(t, getWithToken(router, "/protected", after), http.StatusOK)
+	}
+
+	// The cutoff is also enforced once it is read back from the database
+	withConfig(t, func(c *config.Config) { c.RevocationCacheTTL = 0 })
+	before := generateTestJWT(t, user)
+	if err := utils.RevokeUserTokens(user.ID); err != nil {
+		t.Fatalf("Failed to revoke tokens: %v", err)
+	}
+	expectCode(t, getWithToken(router, "/protected", before), http.StatusUnauthorized, "token_revoked")
+	expectStatus(t, getWithToken(router, "/protected", generateTestJWT(t, user)), http.StatusOK)
+}
+
+func TestImpersonationEndsWhenAdminIsSignedOut(t *testing.T) {
+	admin := createTestUserWithRole(t, "revoke-impersonator@example.com", models.RoleAdmin)
+	user := createTestUser(t, "revoke-impersonated@example.com")
+	router := newRevocationRouter()
+
+	token, _, err := utils.GenerateImpersonationToken(user.ID, user.Role, admin.ID, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	expectStatus(t, getWithToken(router, "/protected", token), http.StatusOK)
+
+	if err := signOutUser(admin.ID); err != nil {
+		t.Fatalf("Failed to sign out admin: %v", err)
+	}
+	expectStatus(t, getWithToken(router, "/protected", token), http.StatusUnauthorized)
+}
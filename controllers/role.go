@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// RoleRequest represents the request body for creating or updating a role
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// AssignRoleRequest represents the request body for changing a user's role
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// findPermissions loads the permissions with the given names and reports the first unknown one
+func findPermissions(names []string) ([]models.Permission, string, error) {
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, "", nil
+	}
+
+	if err := database.DB.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, "", err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		found[permission.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, name, nil
+		}
+	}
+
+	return permissions, "", nil
+}
+
+// ListRoles returns all roles with their permissions
+func ListRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := database.DB.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"roles":  roles,
+	})
+}
+
+// ListPermissions returns every permission that can be granted to a role
+func ListPermissions(c *gin.Context) {
+	var permissions []models.Permission
+	if err := database.DB.Order("name").Find(&permissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "success",
+		"permissions": permissions,
+	})
+}
+
+// CreateRole creates a new role with the given permissions
+func CreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if name == "" || len(name) > 20 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name is required and must be at most 20 characters"})
+		return
+	}
+
+	permissions, unknown, err := findPermissions(req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if unknown != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + unknown})
+		return
+	}
+
+	role := models.Role{
+		Name:        name,
+		Description: req.Description,
+		Permissions: permissions,
+	}
+	if err := database.DB.Create(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "success",
+		"role":   role,
+	})
+}
+
+// UpdateRole changes the description and permissions of a role
+func UpdateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check if the ID is a valid number
+	roleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	var role models.Role
+	if result := database.DB.First(&role, roleID); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	// The admin role is re-granted every permission on start, editing it would not stick
+	if role.Name == models.RoleAdmin && req.Permissions != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The permissions of the admin role cannot be changed"})
+		return
+	}
+
+	var permissions []models.Permission
+	if req.Permissions != nil {
+		var unknown string
+		var err error
+		permissions, unknown, err = findPermissions(req.Permissions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if unknown != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + unknown})
+			return
+		}
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Description != "" {
+			if err := tx.Model(&role).Update("description", req.Description).Error; err != nil {
+				return err
+			}
+		}
+		if permissions == nil {
+			return nil
+		}
+		return tx.Model(&role).Association("Permissions").Replace(permissions)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	utils.InvalidateRolePermissions(role.Name)
+
+	database.DB.Preload("Permissions").First(&role, role.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"role":   role,
+	})
+}
+
+// AssignRole changes the role of a user. The user's existing access tokens are
+// revoked so the new role applies from their next token refresh.
+func AssignRole(c *gin.Context) {
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := findUserByParam(c)
+	if !ok {
+		return
+	}
+
+	var role models.Role
+	if result := database.DB.Where("name = ?", strings.ToLower(req.Role)).First(&role); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + req.Role})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	previousRole := user.Role
+	if err := database.DB.Model(user).Update("role", role.Name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+
+	if err := utils.RevokeUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	auditAdminAction(c, user.ID, models.AuthEventRoleChanged,
+		fmt.Sprintf("Role changed from %s to %s", previousRole, role.Name))
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Role assigned successfully",
+		"user": gin.H{
+			"id":    user.ID,
+			"email": user.Email,
+			"role":  role.Name,
+		},
+	})
+}
@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateRoleRejectsInvalidID(t *testing.T) {
+	router := gin.New()
+	router.PUT("/admin/roles/:id", UpdateRole)
+
+	for _, id := range []string{"abc", "1%20OR%201=1", "-1"} {
+		w := performJSON(t, router, http.MethodPut, "/admin/roles/"+id, RoleRequest{Description: "Changed"})
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,347 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/middleware"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// startSession creates a new session for the user on the requesting device and
+// returns a JWT and refresh token bound to it
+func startSession(c *gin.Context, user *models.User) (string, string, error) {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > models.MaxUserAgentLength {
+		userAgent = userAgent[:models.MaxUserAgentLength]
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:     user.ID,
+		UserAgent:  userAgent,
+		IPAddress:  c.ClientIP(),
+		LastUsedAt: now,
+		ExpiresAt:  now.AddDate(0, 0, config.GetSessionLifetime()),
+	}
+
+	var refreshToken string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		refreshToken, err = issueRefreshToken(tx, &session)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	token, err := utils.GenerateJWT(user.ID, user.Role, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, refreshToken, nil
+}
+
+// respondWithSession starts a session for the user, who logged in with the
+// given method, and writes the login response with any extra fields
+func respondWithSession(c *gin.Context, user *models.User, method string, extra gin.H) {
+	if !checkAccountActive(c, user, models.AuthEventLogin) {
+		return
+	}
+
+	token, refreshToken, err := startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	recordAuthEvent(c, user.ID, models.AuthEventLogin, models.AuthOutcomeSuccess, "Logged in with "+method)
+
+	body := gin.H{
+		"user": gin.H{
+			"id":              user.ID,
+			"name":            user.Name,
+			"surname":         user.Surname,
+			"email":           user.Email,
+			"role":            user.Role,
+			"profileImage":    user.ProfileImage,
+			"referral":        user.ReferralSource,
+			"company":         user.CompanyName,
+			"currentPosition": user.Position,
+		},
+	}
+	for key, value := range extra {
+		body[key] = value
+	}
+	writeTokens(c, body, token, refreshToken)
+}
+
+// writeTokens adds a new token pair to a login or refresh response. Browsers in
+// cookie mode receive the tokens as HttpOnly cookies and only the CSRF token in
+// the body, other clients receive the tokens in the body.
+func writeTokens(c *gin.Context, body gin.H, token, refreshToken string) {
+	if middleware.UsesAuthCookies(c) {
+		csrfToken, err := middleware.SetAuthCookies(c, token, refreshToken)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+			return
+		}
+		body["csrf_token"] = csrfToken
+	} else {
+		body["token"] = token
+		body["refresh_token"] = refreshToken
+	}
+
+	c.JSON(http.StatusOK, body)
+}
+
+// checkAccountActive rejects a login or token refresh, recorded as an auth event
+// of the given type, for an account that is not active. Only active accounts
+// are let through by AuthMiddleware, so tokens of any other account are useless.
+func checkAccountActive(c *gin.Context, user *models.User, eventType string) bool {
+	if user.Status == models.UserStatusActive {
+		return true
+	}
+
+	recordAuthEvent(c, user.ID, eventType, models.AuthOutcomeFailure, "Account is "+user.Status)
+
+	switch user.Status {
+	case models.UserStatusPending:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address has not been verified", "code": "email_not_verified"})
+	case models.UserStatusSuspended:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account has been suspended", "code": "account_suspended"})
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active", "code": "account_" + user.Status})
+	}
+	return false
+}
+
+// issueRefreshToken creates a new refresh token in the session's token family.
+// The token expires when unused for REFRESH_TOKEN_EXPIRATION days, but never
+// outlives the session itself.
+func issueRefreshToken(tx *gorm.DB, session *models.Session) (string, error) {
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().AddDate(0, 0, config.GetRefreshTokenExpiration())
+	if expiresAt.After(session.ExpiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+
+	record := models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: expiresAt,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+// rotateRefreshToken marks the presented token as used and issues its successor.
+// It returns errRefreshTokenReused when the token was already rotated.
+func rotateRefreshToken(c *gin.Context, record *models.RefreshToken, session *models.Session) (string, error) {
+	var refreshToken string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Only one request can rotate a given token
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND rotated_at IS NULL", record.ID).
+			Update("rotated_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		var err error
+		refreshToken, err = issueRefreshToken(tx, session)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(session).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"ip_address":   c.ClientIP(),
+		}).Error
+	})
+
+	return refreshToken, err
+}
+
+// errRefreshTokenReused is returned when an already rotated refresh token is presented again
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// handleRefreshTokenReuse revokes the whole token family of a replayed refresh token
+// and records an auth event, since either the client or an attacker holds a stolen token
+func handleRefreshTokenReuse(c *gin.Context, session *models.Session) {
+	if session.RevokedAt == nil {
+		if err := revokeSession(session); err != nil {
+			log.Printf("Failed to revoke session %d after refresh token reuse: %v", session.ID, err)
+		}
+	}
+
+	recordAuthEvent(c, session.UserID, models.AuthEventRefreshTokenReuse, models.AuthOutcomeFailure,
+		fmt.Sprintf("Rotated refresh token of session %d was presented again, session revoked", session.ID))
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, please log in again", "code": "refresh_token_reused"})
+}
+
+// revokeSession revokes a session so that neither its refresh tokens nor its
+// access tokens can be used anymore
+func revokeSession(session *models.Session) error {
+	if err := database.DB.Model(session).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+
+	utils.MarkSessionRevoked(session.ID)
+	return nil
+}
+
+// revokeUserSessions revokes all active sessions of a user except the given one
+func revokeUserSessions(userID uint, exceptSessionID uint) error {
+	var sessionIDs []uint
+	err := database.DB.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptSessionID).
+		Pluck("id", &sessionIDs).Error
+	if err != nil || len(sessionIDs) == 0 {
+		return err
+	}
+
+	if err := database.DB.Model(&models.Session{}).Where("id IN ?", sessionIDs).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		utils.MarkSessionRevoked(sessionID)
+	}
+	return nil
+}
+
+// currentSessionID returns the session ID carried by the JWT, or 0 for older tokens
+func currentSessionID(c *gin.Context) uint {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		return 0
+	}
+	return sessionID.(uint)
+}
+
+// ListSessions returns the active sessions of the current user
+func ListSessions(c *gin.Context) {
+	// Get user ID from JWT token (set by AuthMiddleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var sessions []models.Session
+	result := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	current := currentSessionID(c)
+	items := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, gin.H{
+			"id":           session.ID,
+			"user_agent":   session.UserAgent,
+			"ip_address":   session.IPAddress,
+			"created_at":   session.CreatedAt,
+			"last_used_at": session.LastUsedAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      session.ID == current,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"sessions": items,
+	})
+}
+
+// RevokeSession revokes a single session of the current user
+func RevokeSession(c *gin.Context) {
+	// Get user ID from JWT token (set by AuthMiddleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Check if the ID is a valid number
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	// Only sessions owned by the current user can be revoked
+	var session models.Session
+	result := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).First(&session)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if err := revokeSession(&session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeOtherSessions revokes every session of the current user except the current one
+func RevokeOtherSessions(c *gin.Context) {
+	// Get user ID from JWT token (set by AuthMiddleware)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := revokeUserSessions(userID.(uint), currentSessionID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Other sessions revoked successfully",
+	})
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// errInvalidStatusTransition is returned when an account cannot move to the requested status
+var errInvalidStatusTransition = errors.New("invalid status transition")
+
+// changeUserStatus moves a user to a new account status and records who made
+// the change and why. The acting user is taken from the request context; the
+// change is attributed to the system for unauthenticated requests. Suspended
+// and deleted users are signed out everywhere, and restoring a deleted user
+// cancels a pending self-service deletion.
+func changeUserStatus(c *gin.Context, user *models.User, status, reason string) error {
+	// The personal data of a purged account is gone, there is nothing left to restore
+	if !models.CanTransitionUserStatus(user.Status, status) || user.AnonymizedAt != nil {
+		return fmt.Errorf("%w from %s to %s", errInvalidStatusTransition, user.Status, status)
+	}
+
+	change := models.UserStatusChange{
+		UserID:     user.ID,
+		FromStatus: user.Status,
+		ToStatus:   status,
+		Reason:     reason,
+	}
+	if actorID, exists := actingUserID(c); exists {
+		change.ChangedBy = &actorID
+	}
+
+	// Sign out before a soft deletion, the token cutoff cannot be stored on a deleted user
+	if status == models.UserStatusSuspended || status == models.UserStatusDeleted {
+		if err := signOutUser(user.ID); err != nil {
+			return err
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(user).Update("status", status).Error; err != nil {
+			return err
+		}
+
+		switch {
+		case status == models.UserStatusDeleted:
+			if err := tx.Delete(user).Error; err != nil {
+				return err
+			}
+		case change.FromStatus == models.UserStatusDeleted:
+			err := tx.Unscoped().Model(user).Updates(map[string]interface{}{
+				"deleted_at":            nil,
+				"deletion_requested_at": nil,
+			}).Error
+			if err != nil {
+				return err
+			}
+		case change.FromStatus == models.UserStatusPending:
+			// Activating a pending account also confirms its email address
+			if err := tx.Model(user).Where("email_verified_at IS NULL").Update("email_verified_at", time.Now()).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&change).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	utils.MarkUserStatus(user.ID, status)
+	return nil
+}
+
+// claimPendingAccount activates a pending account whose email address was just
+// proven by its owner. Whoever registered the account never proved the address,
+// so the password they chose and any sessions are dropped; the owner can set a
+// password with a password reset.
+func claimPendingAccount(c *gin.Context, user *models.User, reason string) error {
+	if err := database.DB.Model(user).Update("password", "").Error; err != nil {
+		return err
+	}
+	if err := signOutUser(user.ID); err != nil {
+		return err
+	}
+	if err := changeUserStatus(c, user, models.UserStatusActive, reason); err != nil {
+		return err
+	}
+	return database.DB.First(user, user.ID).Error
+}
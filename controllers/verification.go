@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/mailer"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// VerifyEmailRequest represents the request body for email verification
+type VerifyEmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Code  string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// ResendVerificationRequest represents the request body for resending the verification code
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Errors returned while issuing or checking one-time codes
+var (
+	errCodeInvalid   = errors.New("invalid verification code")
+	errCodeExpired   = errors.New("verification code expired")
+	errCodeAttempts  = errors.New("too many verification attempts")
+	errCodeThrottled = errors.New("verification code requested too recently")
+)
+
+// issueVerificationCode generates a new one-time code for the user and purpose,
+// invalidating any code that was issued before it
+func issueVerificationCode(userID uint, purpose string) (string, error) {
+	// Throttle how often a new code can be requested
+	var latest models.VerificationCode
+	result := database.DB.Where("user_id = ? AND purpose = ?", userID, purpose).Order("created_at DESC").First(&latest)
+	if result.Error == nil {
+		if time.Since(latest.CreatedAt) < time.Duration(config.GetOTPResendInterval())*time.Second {
+			return "", errCodeThrottled
+		}
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return "", result.Error
+	}
+
+	code, err := utils.GenerateOTP()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the most recent code is valid
+		if err := tx.Model(&models.VerificationCode{}).
+			Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", userID, purpose).
+			Update("consumed_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.VerificationCode{
+			UserID:    userID,
+			Purpose:   purpose,
+			CodeHash:  utils.HashToken(code),
+			ExpiresAt: now.Add(time.Duration(config.GetOTPExpiration()) * time.Minute),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// consumeVerificationCode checks a code against the latest outstanding code for the
+// user and purpose and marks it as used on success
+func consumeVerificationCode(userID uint, purpose, code string) error {
+	vc, err := checkVerificationCode(userID, purpose, code)
+	if err != nil {
+		return err
+	}
+	return markVerificationCodeConsumed(vc)
+}
+
+// checkVerificationCode checks a code against the latest outstanding code for
+// the user and purpose without using it up. Each check counts as an attempt.
+func checkVerificationCode(userID uint, purpose, code string) (*models.VerificationCode, error) {
+	var vc models.VerificationCode
+	result := database.DB.Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", userID, purpose).
+		Order("created_at DESC").First(&vc)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errCodeInvalid
+		}
+		return nil, result.Error
+	}
+
+	if time.Now().After(vc.ExpiresAt) {
+		return nil, errCodeExpired
+	}
+
+	// Every guess takes an attempt before it is compared, so concurrent guesses
+	// cannot get past the limit
+	result = database.DB.Model(&models.VerificationCode{}).
+		Where("id = ? AND attempts < ?", vc.ID, config.GetOTPMaxAttempts()).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errCodeAttempts
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(code)), []byte(vc.CodeHash)) != 1 {
+		return nil, errCodeInvalid
+	}
+
+	return &vc, nil
+}
+
+// markVerificationCodeConsumed uses up a checked code
+func markVerificationCodeConsumed(vc *models.VerificationCode) error {
+	// Guard against the same code being used twice concurrently
+	result := database.DB.Model(&models.VerificationCode{}).
+		Where("id = ? AND consumed_at IS NULL", vc.ID).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errCodeInvalid
+	}
+
+	return nil
+}
+
+// respondCodeError writes the response for an error returned by the code helpers
+func respondCodeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errCodeInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code", "code": "invalid_code"})
+	case errors.Is(err, errCodeExpired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification code has expired", "code": "code_expired"})
+	case errors.Is(err, errCodeAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, please request a new code", "code": "too_many_attempts"})
+	case errors.Is(err, errCodeThrottled):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting a new code", "code": "too_many_requests"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
+
+// sendVerificationEmail issues a new email verification code and mails it to the user
+func sendVerificationEmail(user *models.User) error {
+	code, err := issueVerificationCode(user.ID, models.VerificationPurposeEmail)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Ambridge account",
+		Body: fmt.Sprintf("Hi %s,\n\nYour Ambridge verification code is: %s\n\nThe code expires in %d minutes.",
+			user.Name, code, config.GetOTPExpiration()),
+	})
+}
+
+// VerifyEmail confirms a user's email address with the code sent at registration
+func VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Find user by email
+	var user models.User
+	result := database.DB.Where("email = ?", strings.ToLower(req.Email)).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			respondCodeError(c, errCodeInvalid)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if user.IsEmailVerified() {
+		c.JSON(http.StatusOK, gin.H{"message": "Email already verified"})
+		return
+	}
+
+	if err := consumeVerificationCode(user.ID, models.VerificationPurposeEmail, req.Code); err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	// Mark the email as verified
+	now := time.Now()
+	if err := database.DB.Model(&user).Update("email_verified_at", now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	// Verifying the email address activates a newly registered account
+	if user.Status == models.UserStatusPending {
+		if err := changeUserStatus(c, &user, models.UserStatusActive, "Email address verified"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate account"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification sends a new verification code to an unverified account
+func ResendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "If the account exists and is not verified, a new verification code has been sent"
+
+	// Find user by email
+	var user models.User
+	result := database.DB.Where("email = ?", strings.ToLower(req.Email)).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusOK, gin.H{"message": message})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if user.IsEmailVerified() {
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+
+	if err := sendVerificationEmail(&user); err != nil {
+		if errors.Is(err, errCodeThrottled) {
+			respondCodeError(c, err)
+			return
+		}
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
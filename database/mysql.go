@@ -1,6 +1,7 @@
 package database
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"time"
@@ -35,6 +36,8 @@ func InitDB() {
 	var err error
 	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
 		Logger: newLogger,
+		// Report unique index violations as gorm.ErrDuplicatedKey
+		TranslateError: true,
 	})
 
 	if err != nil {
@@ -54,6 +57,7 @@ func AutoMigrate() error {
 		name VARCHAR(100),
 		surname VARCHAR(100),
 		email VARCHAR(255) NOT NULL,
+		pending_email VARCHAR(255),
 		password VARCHAR(255) NOT NULL,
 		profile_image VARCHAR(255),
 		company_name VARCHAR(100),
@@ -63,13 +67,21 @@ func AutoMigrate() error {
 		position VARCHAR(100),
 		referral_source VARCHAR(100),
 		role VARCHAR(20) DEFAULT 'user',
-		refresh_token VARCHAR(255),
+		status VARCHAR(20) NOT NULL DEFAULT 'active',
 		resume_file VARCHAR(255),
+		email_verified_at DATETIME(3) NULL,
+		tokens_valid_after DATETIME(3) NULL,
+		deletion_requested_at DATETIME(3) NULL,
+		anonymized_at DATETIME(3) NULL,
+		totp_secret VARCHAR(64),
+		totp_enabled_at DATETIME(3) NULL,
+		totp_last_used_step BIGINT NOT NULL DEFAULT 0,
 		created_at DATETIME(3) NULL,
 		updated_at DATETIME(3) NULL,
 		deleted_at DATETIME(3) NULL,
 		UNIQUE INDEX idx_users_email (email),
 		INDEX idx_users_role (role),
+		INDEX idx_users_status (status),
 		INDEX idx_users_deleted_at (deleted_at)
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 	`
@@ -80,6 +92,92 @@ func AutoMigrate() error {
 		return err
 	}
 
+	// Accounts created before email verification existed are treated as verified
+	added, err := addColumnIfMissing("users", "email_verified_at", "DATETIME(3) NULL")
+	if err != nil {
+		log.Fatalf("Failed to add email_verified_at column: %v", err)
+		return err
+	}
+	if added {
+		if err := DB.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			log.Fatalf("Failed to backfill email_verified_at: %v", err)
+			return err
+		}
+	}
+
+	if _, err := addColumnIfMissing("users", "tokens_valid_after", "DATETIME(3) NULL"); err != nil {
+		log.Fatalf("Failed to add tokens_valid_after column: %v", err)
+		return err
+	}
+
+	// Self-service account deletion columns
+	deletionColumns := []struct{ name, definition string }{
+		{"deletion_requested_at", "DATETIME(3) NULL"},
+		{"anonymized_at", "DATETIME(3) NULL"},
+	}
+	for _, column := range deletionColumns {
+		if _, err := addColumnIfMissing("users", column.name, column.definition); err != nil {
+			log.Fatalf("Failed to add %s column: %v", column.name, err)
+			return err
+		}
+	}
+
+	// Derive the account status of existing users from their previous state
+	added, err = addColumnIfMissing("users", "status", "VARCHAR(20) NOT NULL DEFAULT 'active'")
+	if err != nil {
+		log.Fatalf("Failed to add status column: %v", err)
+		return err
+	}
+	if added {
+		backfill := []string{
+			"CREATE INDEX idx_users_status ON users (status)",
+			"UPDATE users SET status = 'pending' WHERE email_verified_at IS NULL",
+			"UPDATE users SET status = 'deleted' WHERE deleted_at IS NOT NULL",
+		}
+		if exists, err := columnExists("users", "suspended_at"); err != nil {
+			log.Fatalf("Failed to check suspended_at column: %v", err)
+			return err
+		} else if exists {
+			backfill = append(backfill, "UPDATE users SET status = 'suspended' WHERE suspended_at IS NOT NULL AND deleted_at IS NULL")
+		}
+		for _, statement := range backfill {
+			if err := DB.Exec(statement).Error; err != nil {
+				log.Fatalf("Failed to backfill user status: %v", err)
+				return err
+			}
+		}
+	}
+
+	// Suspension is part of the status now
+	if err := dropColumnIfExists("users", "suspended_at"); err != nil {
+		log.Fatalf("Failed to drop suspended_at column: %v", err)
+		return err
+	}
+
+	if _, err := addColumnIfMissing("users", "pending_email", "VARCHAR(255)"); err != nil {
+		log.Fatalf("Failed to add pending_email column: %v", err)
+		return err
+	}
+
+	// Two-factor authentication columns
+	totpColumns := []struct{ name, definition string }{
+		{"totp_secret", "VARCHAR(64)"},
+		{"totp_enabled_at", "DATETIME(3) NULL"},
+		{"totp_last_used_step", "BIGINT NOT NULL DEFAULT 0"},
+	}
+	for _, column := range totpColumns {
+		if _, err := addColumnIfMissing("users", column.name, column.definition); err != nil {
+			log.Fatalf("Failed to add %s column: %v", column.name, err)
+			return err
+		}
+	}
+
+	// Refresh tokens moved to the sessions table, drop the plaintext column
+	if err := dropColumnIfExists("users", "refresh_token"); err != nil {
+		log.Fatalf("Failed to drop refresh_token column: %v", err)
+		return err
+	}
+
 	projectTableSQL := `
 	CREATE TABLE IF NOT EXISTS projects (
 		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
@@ -98,9 +196,11 @@ func AutoMigrate() error {
 		youtube_link VARCHAR(255),
 		github_link VARCHAR(255),
 		insta_link VARCHAR(255),
+		owner_id BIGINT UNSIGNED NULL,
 		created_at DATETIME(3) NULL,
 		updated_at DATETIME(3) NULL,
 		deleted_at DATETIME(3) NULL,
+		INDEX idx_projects_owner_id (owner_id),
 		INDEX idx_projects_deleted_at (deleted_at)
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 	`
@@ -111,6 +211,20 @@ func AutoMigrate() error {
 		return err
 	}
 
+	// Projects created before ownership existed have no owner and can only be
+	// edited by users with the projects:write permission
+	added, err = addColumnIfMissing("projects", "owner_id", "BIGINT UNSIGNED NULL")
+	if err != nil {
+		log.Fatalf("Failed to add owner_id column: %v", err)
+		return err
+	}
+	if added {
+		if err := DB.Exec("CREATE INDEX idx_projects_owner_id ON projects (owner_id)").Error; err != nil {
+			log.Fatalf("Failed to create idx_projects_owner_id index: %v", err)
+			return err
+		}
+	}
+
 	crewTableSQL := `
 	CREATE TABLE IF NOT EXISTS crews (
 		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
@@ -131,6 +245,470 @@ func AutoMigrate() error {
 		return err
 	}
 
+	verificationCodeTableSQL := `
+	CREATE TABLE IF NOT EXISTS verification_codes (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL,
+		purpose VARCHAR(32) NOT NULL,
+		code_hash VARCHAR(64) NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		expires_at DATETIME(3) NOT NULL,
+		consumed_at DATETIME(3) NULL,
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		INDEX idx_verification_codes_user_id (user_id),
+		INDEX idx_verification_codes_purpose (purpose),
+		INDEX idx_verification_codes_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for verification_codes table
+	if err := DB.Exec(verificationCodeTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create verification_codes table: %v", err)
+		return err
+	}
+
+	sessionTableSQL := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL,
+		user_agent VARCHAR(255),
+		ip_address VARCHAR(45),
+		last_used_at DATETIME(3) NOT NULL,
+		expires_at DATETIME(3) NOT NULL,
+		revoked_at DATETIME(3) NULL,
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		INDEX idx_sessions_user_id (user_id),
+		INDEX idx_sessions_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for sessions table
+	if err := DB.Exec(sessionTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create sessions table: %v", err)
+		return err
+	}
+
+	refreshTokenTableSQL := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		session_id BIGINT UNSIGNED NOT NULL,
+		token_hash VARCHAR(64) NOT NULL,
+		expires_at DATETIME(3) NOT NULL,
+		rotated_at DATETIME(3) NULL,
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_refresh_tokens_token_hash (token_hash),
+		INDEX idx_refresh_tokens_session_id (session_id),
+		INDEX idx_refresh_tokens_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for refresh_tokens table
+	if err := DB.Exec(refreshTokenTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create refresh_tokens table: %v", err)
+		return err
+	}
+
+	// Move the current refresh token of existing sessions into refresh_tokens
+	exists, err := columnExists("sessions", "refresh_token_hash")
+	if err != nil {
+		log.Fatalf("Failed to inspect sessions table: %v", err)
+		return err
+	}
+	if exists {
+		moveSQL := `
+		INSERT INTO refresh_tokens (session_id, token_hash, expires_at, created_at, updated_at)
+		SELECT id, refresh_token_hash, expires_at, updated_at, updated_at FROM sessions
+		WHERE revoked_at IS NULL AND deleted_at IS NULL
+		`
+		if err := DB.Exec(moveSQL).Error; err != nil {
+			log.Fatalf("Failed to move refresh tokens: %v", err)
+			return err
+		}
+		if err := dropColumnIfExists("sessions", "refresh_token_hash"); err != nil {
+			log.Fatalf("Failed to drop refresh_token_hash column: %v", err)
+			return err
+		}
+	}
+
+	authEventTableSQL := `
+	CREATE TABLE IF NOT EXISTS auth_events (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL,
+		type VARCHAR(50) NOT NULL,
+		outcome VARCHAR(20) NOT NULL,
+		ip_address VARCHAR(45),
+		user_agent VARCHAR(255),
+		details TEXT,
+		created_at DATETIME(3) NULL,
+		INDEX idx_auth_events_user_id (user_id),
+		INDEX idx_auth_events_type (type),
+		INDEX idx_auth_events_created_at (created_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for auth_events table
+	if err := DB.Exec(authEventTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create auth_events table: %v", err)
+		return err
+	}
+
+	// Move the events of the former security_events table into auth_events.
+	// Deployments that ran a build with refresh token rotation but without
+	// the auth event log already store refresh token reuse events there, which
+	// must survive the upgrade. Those events predate outcomes, so only reuse is
+	// marked as a failure. The table is dropped once moved, so this only runs
+	// on the first start after the upgrade.
+	exists, err = tableExists("security_events")
+	if err != nil {
+		log.Fatalf("Failed to inspect security_events table: %v", err)
+		return err
+	}
+	if exists {
+		moveSQL := `
+		INSERT INTO auth_events (user_id, type, outcome, ip_address, user_agent, details, created_at)
+		SELECT user_id, type, IF(type = 'refresh_token_reuse', 'failure', 'success'), ip_address, user_agent, details, created_at
+		FROM security_events WHERE deleted_at IS NULL ORDER BY id
+		`
+		if err := DB.Exec(moveSQL).Error; err != nil {
+			log.Fatalf("Failed to move security events: %v", err)
+			return err
+		}
+		if err := DB.Exec("DROP TABLE security_events").Error; err != nil {
+			log.Fatalf("Failed to drop security_events table: %v", err)
+			return err
+		}
+	}
+
+	revokedTokenTableSQL := `
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		jti VARCHAR(64) NOT NULL,
+		user_id BIGINT UNSIGNED NOT NULL,
+		expires_at DATETIME(3) NOT NULL,
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_revoked_tokens_jti (jti),
+		INDEX idx_revoked_tokens_user_id (user_id),
+		INDEX idx_revoked_tokens_expires_at (expires_at),
+		INDEX idx_revoked_tokens_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for revoked_tokens table
+	if err := DB.Exec(revokedTokenTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create revoked_tokens table: %v", err)
+		return err
+	}
+
+	recoveryCodeTableSQL := `
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL,
+		code_hash VARCHAR(64) NOT NULL,
+		used_at DATETIME(3) NULL,
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		INDEX idx_recovery_codes_user_id (user_id),
+		INDEX idx_recovery_codes_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for recovery_codes table
+	if err := DB.Exec(recoveryCodeTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create recovery_codes table: %v", err)
+		return err
+	}
+
+	loginAttemptTableSQL := `
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		` + "`key`" + ` VARCHAR(255) NOT NULL,
+		failures INT NOT NULL DEFAULT 0,
+		last_failure_at DATETIME(3) NOT NULL,
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_login_attempts_key (` + "`key`" + `),
+		INDEX idx_login_attempts_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for login_attempts table
+	if err := DB.Exec(loginAttemptTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create login_attempts table: %v", err)
+		return err
+	}
+
+	roleTableSQL := `
+	CREATE TABLE IF NOT EXISTS roles (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(20) NOT NULL,
+		description VARCHAR(255),
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_roles_name (name),
+		INDEX idx_roles_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for roles table
+	if err := DB.Exec(roleTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create roles table: %v", err)
+		return err
+	}
+
+	permissionTableSQL := `
+	CREATE TABLE IF NOT EXISTS permissions (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(64) NOT NULL,
+		description VARCHAR(255),
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_permissions_name (name),
+		INDEX idx_permissions_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for permissions table
+	if err := DB.Exec(permissionTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create permissions table: %v", err)
+		return err
+	}
+
+	rolePermissionTableSQL := `
+	CREATE TABLE IF NOT EXISTS role_permissions (
+		role_id BIGINT UNSIGNED NOT NULL,
+		permission_id BIGINT UNSIGNED NOT NULL,
+		PRIMARY KEY (role_id, permission_id),
+		INDEX idx_role_permissions_permission_id (permission_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for role_permissions table
+	if err := DB.Exec(rolePermissionTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create role_permissions table: %v", err)
+		return err
+	}
+
+	userStatusChangeTableSQL := `
+	CREATE TABLE IF NOT EXISTS user_status_changes (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL,
+		from_status VARCHAR(20),
+		to_status VARCHAR(20) NOT NULL,
+		changed_by BIGINT UNSIGNED NULL,
+		reason VARCHAR(500),
+		created_at DATETIME(3) NULL,
+		INDEX idx_user_status_changes_user_id (user_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for user_status_changes table
+	if err := DB.Exec(userStatusChangeTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create user_status_changes table: %v", err)
+		return err
+	}
+
+	apiKeyTableSQL := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL,
+		name VARCHAR(100),
+		prefix VARCHAR(16) NOT NULL,
+		secret_hash VARCHAR(64) NOT NULL,
+		scopes VARCHAR(255),
+		expires_at DATETIME(3) NULL,
+		last_used_at DATETIME(3) NULL,
+		revoked_at DATETIME(3) NULL,
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_api_keys_prefix (prefix),
+		INDEX idx_api_keys_user_id (user_id),
+		INDEX idx_api_keys_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for api_keys table
+	if err := DB.Exec(apiKeyTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create api_keys table: %v", err)
+		return err
+	}
+
+	userIdentityTableSQL := `
+	CREATE TABLE IF NOT EXISTS user_identities (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL,
+		provider VARCHAR(50) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		email VARCHAR(255),
+		last_login_at DATETIME(3) NULL,
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_user_identities_provider_subject (provider, subject),
+		INDEX idx_user_identities_user_id (user_id),
+		INDEX idx_user_identities_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for user_identities table
+	if err := DB.Exec(userIdentityTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create user_identities table: %v", err)
+		return err
+	}
+
+	oidcLoginStateTableSQL := `
+	CREATE TABLE IF NOT EXISTS oidc_login_states (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		provider VARCHAR(50) NOT NULL,
+		state_hash VARCHAR(64) NOT NULL,
+		nonce VARCHAR(64) NOT NULL,
+		code_verifier VARCHAR(128) NOT NULL,
+		expires_at DATETIME(3) NOT NULL,
+		created_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_oidc_login_states_state_hash (state_hash),
+		INDEX idx_oidc_login_states_expires_at (expires_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for oidc_login_states table
+	if err := DB.Exec(oidcLoginStateTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create oidc_login_states table: %v", err)
+		return err
+	}
+
+	invitationTableSQL := `
+	CREATE TABLE IF NOT EXISTS invitations (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		code_hash VARCHAR(64) NOT NULL,
+		email VARCHAR(255),
+		role VARCHAR(50) NOT NULL,
+		max_uses INT NOT NULL DEFAULT 1,
+		use_count INT NOT NULL DEFAULT 0,
+		expires_at DATETIME(3) NULL,
+		created_by BIGINT UNSIGNED,
+		revoked_at DATETIME(3) NULL,
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_invitations_code_hash (code_hash),
+		INDEX idx_invitations_email (email),
+		INDEX idx_invitations_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for invitations table
+	if err := DB.Exec(invitationTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create invitations table: %v", err)
+		return err
+	}
+
+	passkeyTableSQL := `
+	CREATE TABLE IF NOT EXISTS passkeys (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL,
+		credential_id VARCHAR(255) NOT NULL,
+		public_key BLOB NOT NULL,
+		algorithm INT NOT NULL,
+		sign_count INT UNSIGNED NOT NULL DEFAULT 0,
+		transports VARCHAR(100),
+		aaguid VARCHAR(36),
+		nickname VARCHAR(100),
+		last_used_at DATETIME(3) NULL,
+		created_at DATETIME(3) NULL,
+		updated_at DATETIME(3) NULL,
+		deleted_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_passkeys_credential_id (credential_id),
+		INDEX idx_passkeys_user_id (user_id),
+		INDEX idx_passkeys_deleted_at (deleted_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for passkeys table
+	if err := DB.Exec(passkeyTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create passkeys table: %v", err)
+		return err
+	}
+
+	passkeyChallengeTableSQL := `
+	CREATE TABLE IF NOT EXISTS passkey_challenges (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+		purpose VARCHAR(20) NOT NULL,
+		challenge_hash VARCHAR(64) NOT NULL,
+		expires_at DATETIME(3) NOT NULL,
+		created_at DATETIME(3) NULL,
+		UNIQUE INDEX idx_passkey_challenges_challenge_hash (challenge_hash),
+		INDEX idx_passkey_challenges_user_id (user_id),
+		INDEX idx_passkey_challenges_expires_at (expires_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// Execute the SQL statement for passkey_challenges table
+	if err := DB.Exec(passkeyChallengeTableSQL).Error; err != nil {
+		log.Fatalf("Failed to create passkey_challenges table: %v", err)
+		return err
+	}
+
+	if err := SeedRoles(); err != nil {
+		log.Fatalf("Failed to seed roles: %v", err)
+		return err
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
+
+// tableExists reports whether a table exists in the current database
+func tableExists(table string) (bool, error) {
+	var count int64
+	err := DB.Raw(
+		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?",
+		table,
+	).Scan(&count).Error
+	return count > 0, err
+}
+
+// columnExists reports whether a column exists in a table of the current database
+func columnExists(table, column string) (bool, error) {
+	var count int64
+	err := DB.Raw(
+		"SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?",
+		table, column,
+	).Scan(&count).Error
+	return count > 0, err
+}
+
+// addColumnIfMissing adds a column to an existing table and reports whether it was added
+func addColumnIfMissing(table, column, definition string) (bool, error) {
+	exists, err := columnExists(table, column)
+	if err != nil || exists {
+		return false, err
+	}
+
+	if err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// dropColumnIfExists removes a column from a table when it is still present
+func dropColumnIfExists(table, column string) error {
+	exists, err := columnExists(table, column)
+	if err != nil || !exists {
+		return err
+	}
+
+	return DB.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)).Error
+}
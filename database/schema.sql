@@ -16,9 +16,18 @@ CREATE TABLE IF NOT EXISTS users (
     position VARCHAR(255),
     referral_source VARCHAR(255),
     role VARCHAR(10) DEFAULT 'user',
-    refresh_token VARCHAR(255),
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
     resume_file VARCHAR(255),
+    email_verified_at DATETIME(3) NULL,
+    tokens_valid_after DATETIME(3) NULL,
+    deletion_requested_at DATETIME(3) NULL,
+    anonymized_at DATETIME(3) NULL,
+    pending_email VARCHAR(255),
+    totp_secret VARCHAR(64),
+    totp_enabled_at DATETIME(3) NULL,
+    totp_last_used_step BIGINT NOT NULL DEFAULT 0,
     UNIQUE INDEX idx_users_email (email),
+    INDEX idx_users_status (status),
     INDEX idx_users_deleted_at (deleted_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
@@ -43,6 +52,8 @@ CREATE TABLE IF NOT EXISTS projects (
     youtube_link VARCHAR(255),
     github_link VARCHAR(255),
     insta_link VARCHAR(255),
+    owner_id BIGINT UNSIGNED NULL,
+    INDEX idx_projects_owner_id (owner_id),
     INDEX idx_projects_deleted_at (deleted_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
@@ -57,4 +68,267 @@ CREATE TABLE IF NOT EXISTS crews (
     about TEXT,
     urlphoto VARCHAR(255),
     INDEX idx_crews_deleted_at (deleted_at)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create verification_codes table
+CREATE TABLE IF NOT EXISTS verification_codes (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    purpose VARCHAR(32) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at DATETIME(3) NOT NULL,
+    consumed_at DATETIME(3) NULL,
+    INDEX idx_verification_codes_user_id (user_id),
+    INDEX idx_verification_codes_purpose (purpose),
+    INDEX idx_verification_codes_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create sessions table
+CREATE TABLE IF NOT EXISTS sessions (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    user_agent VARCHAR(255),
+    ip_address VARCHAR(45),
+    last_used_at DATETIME(3) NOT NULL,
+    expires_at DATETIME(3) NOT NULL,
+    revoked_at DATETIME(3) NULL,
+    INDEX idx_sessions_user_id (user_id),
+    INDEX idx_sessions_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create refresh_tokens table
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    session_id BIGINT UNSIGNED NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    expires_at DATETIME(3) NOT NULL,
+    rotated_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_refresh_tokens_token_hash (token_hash),
+    INDEX idx_refresh_tokens_session_id (session_id),
+    INDEX idx_refresh_tokens_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create auth_events table
+CREATE TABLE IF NOT EXISTS auth_events (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent VARCHAR(255),
+    details TEXT,
+    INDEX idx_auth_events_user_id (user_id),
+    INDEX idx_auth_events_type (type),
+    INDEX idx_auth_events_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create revoked_tokens table
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    jti VARCHAR(64) NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    expires_at DATETIME(3) NOT NULL,
+    UNIQUE INDEX idx_revoked_tokens_jti (jti),
+    INDEX idx_revoked_tokens_user_id (user_id),
+    INDEX idx_revoked_tokens_expires_at (expires_at),
+    INDEX idx_revoked_tokens_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create recovery_codes table
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at DATETIME(3) NULL,
+    INDEX idx_recovery_codes_user_id (user_id),
+    INDEX idx_recovery_codes_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create login_attempts table
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    `key` VARCHAR(255) NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at DATETIME(3) NOT NULL,
+    UNIQUE INDEX idx_login_attempts_key (`key`),
+    INDEX idx_login_attempts_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create roles table
+CREATE TABLE IF NOT EXISTS roles (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    name VARCHAR(20) NOT NULL,
+    description VARCHAR(255),
+    UNIQUE INDEX idx_roles_name (name),
+    INDEX idx_roles_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create permissions table
+CREATE TABLE IF NOT EXISTS permissions (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    name VARCHAR(64) NOT NULL,
+    description VARCHAR(255),
+    UNIQUE INDEX idx_permissions_name (name),
+    INDEX idx_permissions_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create role_permissions table
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id BIGINT UNSIGNED NOT NULL,
+    permission_id BIGINT UNSIGNED NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    INDEX idx_role_permissions_permission_id (permission_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create user_status_changes table
+CREATE TABLE IF NOT EXISTS user_status_changes (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    changed_by BIGINT UNSIGNED NULL,
+    reason VARCHAR(500),
+    INDEX idx_user_status_changes_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create api_keys table
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(100),
+    prefix VARCHAR(16) NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL,
+    scopes VARCHAR(255),
+    expires_at DATETIME(3) NULL,
+    last_used_at DATETIME(3) NULL,
+    revoked_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_api_keys_prefix (prefix),
+    INDEX idx_api_keys_user_id (user_id),
+    INDEX idx_api_keys_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create user_identities table
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    last_login_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_user_identities_provider_subject (provider, subject),
+    INDEX idx_user_identities_user_id (user_id),
+    INDEX idx_user_identities_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create oidc_login_states table
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    provider VARCHAR(50) NOT NULL,
+    state_hash VARCHAR(64) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    expires_at DATETIME(3) NOT NULL,
+    UNIQUE INDEX idx_oidc_login_states_state_hash (state_hash),
+    INDEX idx_oidc_login_states_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create invitations table
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    email VARCHAR(255),
+    role VARCHAR(50) NOT NULL,
+    max_uses INT NOT NULL DEFAULT 1,
+    use_count INT NOT NULL DEFAULT 0,
+    expires_at DATETIME(3) NULL,
+    created_by BIGINT UNSIGNED,
+    revoked_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_invitations_code_hash (code_hash),
+    INDEX idx_invitations_email (email),
+    INDEX idx_invitations_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create passkeys table
+CREATE TABLE IF NOT EXISTS passkeys (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    credential_id VARCHAR(255) NOT NULL,
+    public_key BLOB NOT NULL,
+    algorithm INT NOT NULL,
+    sign_count INT UNSIGNED NOT NULL DEFAULT 0,
+    transports VARCHAR(100),
+    aaguid VARCHAR(36),
+    nickname VARCHAR(100),
+    last_used_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_passkeys_credential_id (credential_id),
+    INDEX idx_passkeys_user_id (user_id),
+    INDEX idx_passkeys_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create passkey_challenges table
+CREATE TABLE IF NOT EXISTS passkey_challenges (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    user_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    purpose VARCHAR(20) NOT NULL,
+    challenge_hash VARCHAR(64) NOT NULL,
+    expires_at DATETIME(3) NOT NULL,
+    UNIQUE INDEX idx_passkey_challenges_challenge_hash (challenge_hash),
+    INDEX idx_passkey_challenges_user_id (user_id),
+    INDEX idx_passkey_challenges_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Built-in roles and permissions
+INSERT IGNORE INTO permissions (name, description, created_at, updated_at) VALUES
+    ('projects:write', 'Edit and delete any project', NOW(3), NOW(3)),
+    ('crew:write', 'Create, update and delete crew members', NOW(3), NOW(3)),
+    ('users:manage', 'View and manage user accounts', NOW(3), NOW(3)),
+    ('users:impersonate', 'Act as another user to see what they see', NOW(3), NOW(3)),
+    ('roles:manage', 'Manage roles and assign them to users', NOW(3), NOW(3));
+
+INSERT IGNORE INTO roles (name, description, created_at, updated_at) VALUES
+    ('admin', 'Administrator with every permission', NOW(3), NOW(3)),
+    ('user', 'Regular user', NOW(3), NOW(3));
+
+INSERT IGNORE INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles CROSS JOIN permissions WHERE roles.name = 'admin';
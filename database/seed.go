@@ -0,0 +1,38 @@
+package database
+
+import (
+	"ambridge-backend/models"
+)
+
+// SeedRoles creates the built-in permissions and roles. It is safe to run on
+// every start: existing rows are kept and the admin role is granted any
+// permission that was added since the last run.
+func SeedRoles() error {
+	for name, description := range models.DefaultPermissions {
+		if err := DB.Exec(
+			"INSERT IGNORE INTO permissions (name, description, created_at, updated_at) VALUES (?, ?, NOW(3), NOW(3))",
+			name, description,
+		).Error; err != nil {
+			return err
+		}
+	}
+
+	roles := map[string]string{
+		models.RoleAdmin: "Administrator with every permission",
+		models.RoleUser:  "Regular user",
+	}
+	for name, description := range roles {
+		if err := DB.Exec(
+			"INSERT IGNORE INTO roles (name, description, created_at, updated_at) VALUES (?, ?, NOW(3), NOW(3))",
+			name, description,
+		).Error; err != nil {
+			return err
+		}
+	}
+
+	return DB.Exec(
+		"INSERT IGNORE INTO role_permissions (role_id, permission_id) "+
+			"SELECT roles.id, permissions.id FROM roles CROSS JOIN permissions WHERE roles.name = ? AND permissions.deleted_at IS NULL",
+		models.RoleAdmin,
+	).Error
+}
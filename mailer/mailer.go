@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ambridge-backend/config"
+)
+
+// Message represents a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is the transport used to deliver emails
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	defaultMailer Mailer
+	once          sync.Once
+)
+
+// Default returns the mailer selected by the MAIL_TRANSPORT setting
+func Default() Mailer {
+	once.Do(func() {
+		if defaultMailer != nil {
+			return
+		}
+		switch config.GetMailTransport() {
+		case "smtp":
+			defaultMailer = &SMTPMailer{
+				Host:     config.GetSMTPHost(),
+				Port:     config.GetSMTPPort(),
+				User:     config.GetSMTPUser(),
+				Password: config.GetSMTPPassword(),
+				From:     config.GetMailFrom(),
+			}
+		case "file":
+			defaultMailer = &FileMailer{Dir: config.GetMailOutputDir()}
+		default:
+			defaultMailer = &LogMailer{}
+		}
+	})
+	return defaultMailer
+}
+
+// SetDefault replaces the default mailer, e.g. with an in-memory one for tests
+func SetDefault(m Mailer) {
+	once.Do(func() {})
+	defaultMailer = m
+}
+
+// Send delivers a message using the default mailer
+func Send(msg Message) error {
+	return Default().Send(msg)
+}
+
+// LogMailer writes emails to the application log instead of sending them
+type LogMailer struct{}
+
+// Send logs the message
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("[MAIL] To: %s | Subject: %s\n%s\n", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes every email to a separate file in Dir
+type FileMailer struct {
+	Dir string
+}
+
+// Send writes the message to a new file in the output directory
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	// Use a timestamp and the recipient so files sort chronologically
+	recipient := strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405.000000000"), recipient)
+
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", msg.To, msg.Subject, msg.Body)
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(content), 0o644)
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	From     string
+}
+
+// Send delivers the message through the configured SMTP server
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.User != "" {
+		auth = smtp.PlainAuth("", m.User, m.Password, m.Host)
+	}
+
+	content := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		m.From, msg.To, msg.Subject, msg.Body)
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, []byte(content))
+}
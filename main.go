@@ -3,14 +3,17 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
+	"ambridge-backend/config"
 	"ambridge-backend/database"
 	"ambridge-backend/middleware"
 	"ambridge-backend/models"
 	"ambridge-backend/routes"
+	"ambridge-backend/utils"
 )
 
 func main() {
@@ -25,15 +28,34 @@ func main() {
 	// Run auto migrations
 	autoMigrate()
 
+	// Load the JWT signing keys and pick up rotated keys in the background
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	utils.StartKeyReloader(time.Minute)
+
+	// Remove expired token revocations in the background
+	utils.StartRevocationPruner(time.Hour)
+
+	// Purge accounts whose deletion grace period has passed
+	utils.StartAccountSweeper(time.Hour)
+
 	// Set up Gin router
 	router := gin.Default()
 
+	// Only trusted proxies may set the client IP used for lockouts and audit events
+	if err := router.SetTrustedProxies(config.GetTrustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Use custom middlewares
 	router.Use(middleware.CORSMiddleware())
 	router.Use(middleware.LoggerMiddleware())
 
 	// Set up routes
 	routes.SetupAuthRoutes(router)
+	routes.SetupWellKnownRoutes(router)
+	routes.SetupAdminRoutes(router)
 	routes.SetupProjectRoutes(router)
 	routes.SetupCrewRoutes(router)
 
@@ -57,9 +79,28 @@ func autoMigrate() {
 		&models.User{},
 		&models.Project{},
 		&models.Crew{},
+		&models.VerificationCode{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.AuthEvent{},
+		&models.RevokedToken{},
+		&models.RecoveryCode{},
+		&models.LoginAttempt{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserStatusChange{},
+		&models.APIKey{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.Invitation{},
+		&models.Passkey{},
+		&models.PasskeyChallenge{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
+	if err := database.SeedRoles(); err != nil {
+		log.Fatalf("Failed to seed roles: %v", err)
+	}
 	log.Println("Database migrations completed successfully")
 }
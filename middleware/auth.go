@@ -6,47 +6,293 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"ambridge-backend/config"
+	"ambridge-backend/models"
 	"ambridge-backend/utils"
 )
 
-// AuthMiddleware verifies JWT token in the Authorization header
+// AuthMiddleware verifies JWT token in the Authorization header, or in the
+// access token cookie in cookie mode. API keys are accepted as
+// "Authorization: ApiKey <key>" or in the X-API-Key header.
+// For impersonation tokens user_id is the impersonated user and
+// impersonator_id the admin; every such request is recorded.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
+		if key, ok := apiKeyCredential(c); ok {
+			if !authenticateAPIKey(c, key) {
+				return
+			}
+			c.Next()
 			return
 		}
 
-		// Check if the header has the Bearer prefix
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
-			c.Abort()
+		tokenString, ok := accessToken(c)
+		if !ok {
+			return
+		}
+
+		if !authenticateAccessToken(c, tokenString) {
 			return
 		}
 
-		// Extract the token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		c.Next()
+		recordImpersonatedRequest(c)
+	}
+}
+
+// OptionalAuthMiddleware authenticates the request when an Authorization header
+// is present and lets anonymous requests through, for public routes that can
+// tailor their response to the current user
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := apiKeyCredential(c); ok {
+			if !authenticateAPIKey(c, key) {
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if c.GetHeader("Authorization") == "" && accessTokenCookie(c) == "" {
+			c.Next()
+			return
+		}
+
+		tokenString, ok := accessToken(c)
+		if !ok {
+			return
+		}
+
+		if !authenticateAccessToken(c, tokenString) {
+			return
+		}
+
+		c.Next()
+		recordImpersonatedRequest(c)
+	}
+}
+
+// MFAEnrollmentMiddleware accepts either an access token or the enrollment
+// token returned by login when an admin must set up two-factor authentication
+func MFAEnrollmentMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := bearerToken(c)
+		if !ok {
+			return
+		}
 
-		// Verify the token
-		claims, err := utils.VerifyJWT(tokenString)
+		claims, err := utils.VerifyPurposeToken(tokenString, utils.TokenPurposeMFAEnrollment)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			// Not an enrollment token, treat it as an access token. Admins
+			// impersonating a user cannot change their second factor.
+			if !authenticateAccessToken(c, tokenString) {
+				return
+			}
+			RejectImpersonation()(c)
+			return
+		}
+
+		userID, _ := claims.UserID()
+		if revoked, err := utils.IsTokenRevoked(claims.ID); err != nil || revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked", "code": "token_revoked"})
 			c.Abort()
 			return
 		}
 
-		// Set user ID and role in the context
-		c.Set("user_id", uint(claims["user_id"].(float64)))
-		c.Set("role", claims["role"].(string))
+		c.Set("user_id", userID)
+		c.Set("role", claims.Role)
+		c.Set("token_id", claims.ID)
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
+		c.Set("mfa_enrollment", true)
 
 		c.Next()
 	}
 }
 
-// AdminMiddleware ensures the user has admin role
-func AdminMiddleware() gin.HandlerFunc {
+// accessToken returns the access token of the request. Without an Authorization
+// header the token is read from its cookie, in which case state-changing
+// requests must also pass the CSRF check.
+func accessToken(c *gin.Context) (string, bool) {
+	if c.GetHeader("Authorization") == "" {
+		if token := accessTokenCookie(c); token != "" {
+			return token, CheckCSRF(c)
+		}
+	}
+	return bearerToken(c)
+}
+
+// accessTokenCookie returns the access token cookie in cookie mode
+func accessTokenCookie(c *gin.Context) string {
+	if !config.GetAuthCookieMode() {
+		return ""
+	}
+	token, _ := c.Cookie(AccessTokenCookie)
+	return token
+}
+
+// bearerToken extracts the token from the Authorization header, aborting the
+// request when it is missing or malformed
+func bearerToken(c *gin.Context) (string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		c.Abort()
+		return "", false
+	}
+
+	// Check if the header has the Bearer prefix
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
+		c.Abort()
+		return "", false
+	}
+
+	// Extract the token
+	return strings.TrimPrefix(authHeader, "Bearer "), true
+}
+
+// authenticateAccessToken verifies an access token and stores its identity in
+// the context, aborting the request when the token is not valid
+func authenticateAccessToken(c *gin.Context, tokenString string) bool {
+	// Verify the token
+	claims, err := utils.VerifyJWT(tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return false
+	}
+
+	// The subject was validated by VerifyJWT
+	userID, _ := claims.UserID()
+
+	// Reject tokens that were revoked before they expired
+	if !checkTokenRevocation(claims, userID) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked", "code": "token_revoked"})
+		c.Abort()
+		return false
+	}
+
+	// Suspended or deleted accounts lose access immediately
+	status, err := utils.UserStatus(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return false
+	}
+	if status != models.UserStatusActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active", "code": "account_" + status})
+		c.Abort()
+		return false
+	}
+
+	// Impersonation tokens only work while the admin who requested them still could
+	actorID, impersonated := claims.ActorID()
+	if impersonated && !checkImpersonator(claims, actorID) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked", "code": "token_revoked"})
+		c.Abort()
+		return false
+	}
+
+	// Set user ID, role and token details in the context
+	c.Set("user_id", userID)
+	c.Set("role", claims.Role)
+	c.Set("session_id", claims.SessionID)
+	c.Set("token_id", claims.ID)
+	c.Set("token_expires_at", claims.ExpiresAt.Time)
+	if impersonated {
+		c.Set("impersonator_id", actorID)
+	}
+
+	return true
+}
+
+// apiKeyCredential returns the API key sent with the request, if any
+func apiKeyCredential(c *gin.Context) (string, bool) {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key, true
+	}
+
+	authHeader := c.GetHeader("Authorization")
+	if strings.HasPrefix(authHeader, "ApiKey ") {
+		return strings.TrimPrefix(authHeader, "ApiKey "), true
+	}
+	return "", false
+}
+
+// authenticateAPIKey verifies an API key and stores its owner and scopes in the
+// context, aborting the request when the key is not valid
+func authenticateAPIKey(c *gin.Context, key string) bool {
+	apiKey, role, err := utils.AuthenticateAPIKey(key)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key", "code": "invalid_api_key"})
+		c.Abort()
+		return false
+	}
+
+	// Keys of suspended or deleted accounts stop working with the account
+	status, err := utils.UserStatus(apiKey.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key", "code": "invalid_api_key"})
+		c.Abort()
+		return false
+	}
+	if status != models.UserStatusActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active", "code": "account_" + status})
+		c.Abort()
+		return false
+	}
+
+	c.Set("user_id", apiKey.UserID)
+	c.Set("role", role)
+	c.Set("api_key_id", apiKey.ID)
+	c.Set("api_key_scopes", apiKey.ScopeList())
+
+	return true
+}
+
+// HasAPIKeyScope reports whether the request may use the given scope. Requests
+// authenticated with an access token are not limited by scopes.
+func HasAPIKeyScope(c *gin.Context, scope string) bool {
+	scopes, exists := c.Get("api_key_scopes")
+	if !exists {
+		return true
+	}
+
+	for _, granted := range scopes.([]string) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTokenRevocation consults the revocation store and reports whether the token
+// may still be used
+func checkTokenRevocation(claims *utils.Claims, userID uint) bool {
+	revoked, err := utils.IsTokenRevoked(claims.ID)
+	if err != nil || revoked {
+		return false
+	}
+
+	if claims.SessionID != 0 {
+		revoked, err := utils.IsSessionRevoked(claims.SessionID)
+		if err != nil || revoked {
+			return false
+		}
+	}
+
+	// Tokens issued before the user's cutoff, e.g. before a role change, are no longer valid
+	cutoff, err := utils.TokensValidAfter(userID)
+	if err != nil {
+		return false
+	}
+	return !utils.IssuedBeforeCutoff(claims, cutoff)
+}
+
+// RequirePermission ensures the user's role grants the given permission and,
+// for API keys, that the key holds the permission as a scope.
+// It must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, exists := c.Get("role")
 		if !exists {
@@ -55,8 +301,20 @@ func AdminMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		allowed, err := utils.HasPermission(role.(string), permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions", "code": "permission_denied"})
+			c.Abort()
+			return
+		}
+
+		if !HasAPIKeyScope(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the " + permission + " scope", "code": "insufficient_scope"})
 			c.Abort()
 			return
 		}
@@ -65,20 +323,50 @@ func AdminMiddleware() gin.HandlerFunc {
 	}
 }
 
-// CORSMiddleware allows requests from specific origins for frontend integration
+// RequireScope ensures requests made with an API key hold the given scope.
+// Requests made with an access token are let through. It must run after AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasAPIKeyScope(c, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the " + scope + " scope", "code": "insufficient_scope"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RejectAPIKeys restricts routes to users who logged in interactively, so that
+// an API key cannot change the account or create further keys.
+// It must run after AuthMiddleware.
+func RejectAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("api_key_id"); exists {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with an API key", "code": "api_key_not_allowed"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CORSMiddleware allows the origins in CORS_ALLOWED_ORIGINS to call the API
+// with credentials. A '*' entry allows every other origin without credentials.
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
-		if origin != "" {
-			// Allow any origin
+		switch {
+		case origin != "" && isAllowedOrigin(origin):
 			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-		} else {
-			// Fallback to wildcard if no origin header
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		case isAllowedOrigin("*"):
 			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		}
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Writer.Header().Add("Vary", "Origin")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, "+CSRFTokenHeader)
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -86,3 +374,13 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// isAllowedOrigin reports whether the origin is listed in CORS_ALLOWED_ORIGINS
+func isAllowedOrigin(origin string) bool {
+	for _, allowed := range config.GetCORSAllowedOrigins() {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
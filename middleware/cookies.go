@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/config"
+)
+
+// Cookies and header used by the cookie session mode
+const (
+	AccessTokenCookie  = "ambridge_access"
+	RefreshTokenCookie = "ambridge_refresh"
+	CSRFTokenCookie    = "ambridge_csrf" // readable by the frontend, echoed in CSRFTokenHeader
+	CSRFTokenHeader    = "X-CSRF-Token"
+)
+
+// UsesAuthCookies reports whether tokens for this request are exchanged as
+// cookies. Cookies are only used for browsers, recognised by their Origin
+// header, so that other clients keep receiving tokens in the response body.
+func UsesAuthCookies(c *gin.Context) bool {
+	return config.GetAuthCookieMode() && c.GetHeader("Origin") != ""
+}
+
+// SetAuthCookies stores the access and refresh token in HttpOnly cookies and
+// returns the CSRF token the frontend must send with state-changing requests.
+// An existing CSRF token is kept so that other open tabs keep working.
+func SetAuthCookies(c *gin.Context, token, refreshToken string) (string, error) {
+	csrfToken, err := c.Cookie(CSRFTokenCookie)
+	if err != nil || csrfToken == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		csrfToken = hex.EncodeToString(b)
+	}
+
+	sessionAge := config.GetRefreshTokenExpiration() * 24 * 60 * 60
+	setCookie(c, AccessTokenCookie, token, config.GetJWTExpiration()*60*60, true)
+	setCookie(c, RefreshTokenCookie, refreshToken, sessionAge, true)
+	setCookie(c, CSRFTokenCookie, csrfToken, sessionAge, false)
+	return csrfToken, nil
+}
+
+// ClearAuthCookies removes the session cookies from the browser
+func ClearAuthCookies(c *gin.Context) {
+	setCookie(c, AccessTokenCookie, "", -1, true)
+	setCookie(c, RefreshTokenCookie, "", -1, true)
+	setCookie(c, CSRFTokenCookie, "", -1, false)
+}
+
+// setCookie writes a cookie with the configured domain, Secure and SameSite attributes
+func setCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	switch strings.ToLower(config.GetAuthCookieSameSite()) {
+	case "strict":
+		c.SetSameSite(http.SameSiteStrictMode)
+	case "none":
+		c.SetSameSite(http.SameSiteNoneMode)
+	default:
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	c.SetCookie(name, value, maxAge, "/", config.GetAuthCookieDomain(), config.GetAuthCookieSecure(), httpOnly)
+}
+
+// CheckCSRF verifies the double-submitted CSRF token of a request authenticated
+// by cookies, aborting state-changing requests whose header does not match the cookie
+func CheckCSRF(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := c.Cookie(CSRFTokenCookie)
+	header := c.GetHeader(CSRFTokenHeader)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token", "code": "csrf_token_invalid"})
+		c.Abort()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+	"ambridge-backend/utils"
+)
+
+// Impersonator returns the ID of the admin impersonating the current user.
+// The user_id and role in the context are always those of the impersonated user.
+func Impersonator(c *gin.Context) (uint, bool) {
+	actorID, exists := c.Get("impersonator_id")
+	if !exists {
+		return 0, false
+	}
+	return actorID.(uint), true
+}
+
+// RejectImpersonation blocks sensitive actions, such as changing the password
+// or deleting the account, while an admin is impersonating the user
+func RejectImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := Impersonator(c); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action is not allowed while impersonating a user", "code": "impersonation_not_allowed"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkImpersonator verifies that the admin behind an impersonation token is
+// still active and has not been signed out or changed role since it was issued
+func checkImpersonator(claims *utils.Claims, actorID uint) bool {
+	status, err := utils.UserStatus(actorID)
+	if err != nil || status != models.UserStatusActive {
+		return false
+	}
+
+	cutoff, err := utils.TokensValidAfter(actorID)
+	if err != nil {
+		return false
+	}
+	return !utils.IssuedBeforeCutoff(claims, cutoff)
+}
+
+// recordImpersonatedRequest adds a request made with an impersonation token to
+// the impersonated user's auth events. Failures are only logged so that
+// recording never blocks the request.
+func recordImpersonatedRequest(c *gin.Context) {
+	actorID, ok := Impersonator(c)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > models.MaxUserAgentLength {
+		userAgent = userAgent[:models.MaxUserAgentLength]
+	}
+
+	outcome := models.AuthOutcomeSuccess
+	if c.Writer.Status() >= http.StatusBadRequest {
+		outcome = models.AuthOutcomeFailure
+	}
+
+	details := fmt.Sprintf("%s %s returned %d, by admin %d", c.Request.Method, c.Request.URL.Path, c.Writer.Status(), actorID)
+	event := models.AuthEvent{
+		UserID:    userID,
+		Type:      models.AuthEventImpersonatedRequest,
+		Outcome:   outcome,
+		IPAddress: c.ClientIP(),
+		UserAgent: userAgent,
+		Details:   details,
+	}
+	if err := database.DB.Create(&event).Error; err != nil {
+		log.Printf("Failed to record impersonated request for user %d: %v", userID, err)
+		return
+	}
+
+	log.Printf("[IMPERSONATION] user %d from %s: %s", userID, event.IPAddress, details)
+}
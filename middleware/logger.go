@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -23,12 +24,34 @@ func (r responseBodyWriter) Write(b []byte) (int, error) {
 	return r.ResponseWriter.Write(b)
 }
 
-// LoggerMiddleware logs all requests with their paths, methods, request bodies, status codes, and response bodies
+// redactedBodyPrefixes are the paths whose bodies carry passwords, tokens,
+// codes or secrets that are shown only once, so they are never logged
+var redactedBodyPrefixes = []string{"/auth/", "/admin/"}
+
+// hasRedactedBody reports whether the bodies of a request must not be logged
+func hasRedactedBody(path string) bool {
+	for _, prefix := range redactedBodyPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoggerMiddleware logs all requests with their paths, methods, request bodies, status codes, and response bodies.
+// Bodies of authentication and admin requests are left out.
 func LoggerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Start timer
 		startTime := time.Now()
 
+		if hasRedactedBody(c.Request.URL.Path) {
+			c.Next()
+			log.Printf("[REQUEST] %s %s | Status: %d | Latency: %v\n", c.Request.Method, c.Request.URL.Path, c.Writer.Status(), time.Since(startTime))
+			log.Printf("[REQUEST BODY] redacted\n")
+			return
+		}
+
 		// Read the request body
 		var requestBody []byte
 		if c.Request.Body != nil {
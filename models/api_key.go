@@ -0,0 +1,38 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix starts every API key so that leaked keys are easy to recognise
+const APIKeyPrefix = "amb_"
+
+// APIKey represents a long-lived credential a user created for scripts and
+// server-to-server access. Only a hash of the secret is stored.
+type APIKey struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Name       string     `json:"name" gorm:"type:varchar(100)"`
+	Prefix     string     `json:"prefix" gorm:"type:varchar(16);uniqueIndex"` // public part of the key used to look it up
+	SecretHash string     `json:"-" gorm:"type:varchar(64)"`                  // SHA-256 of the whole key
+	Scopes     string     `json:"-" gorm:"type:varchar(255)"`                 // comma separated permission names
+	ExpiresAt  *time.Time `json:"expires_at"`                                 // nil for keys that never expire
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ScopeList returns the scopes granted to the key
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// IsActive reports whether the key can still be used
+func (k *APIKey) IsActive() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
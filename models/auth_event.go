@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// Authentication event types
+const (
+	AuthEventRegister      = "register"
+	AuthEventLogin         = "login"
+	AuthEventLogout        = "logout"
+	AuthEventTokenRefresh  = "token_refresh"
+	AuthEventProfileUpdate = "profile_update"
+	AuthEventRoleLookup    = "role_lookup"
+
+	AuthEventRefreshTokenReuse = "refresh_token_reuse"
+
+	// Actions taken by an admin on the user's account
+	AuthEventUserUnlocked    = "user_unlocked"
+	AuthEventRoleChanged     = "role_changed"
+	AuthEventUserSuspended   = "user_suspended"
+	AuthEventUserReactivated = "user_reactivated"
+	AuthEventUserLoggedOut   = "user_logged_out"
+	AuthEventUserDeleted     = "user_deleted"
+	AuthEventUserRestored    = "user_restored"
+
+	// Impersonation of the user by an admin
+	AuthEventImpersonationStarted = "impersonation_started"
+	AuthEventImpersonationEnded   = "impersonation_ended"
+	AuthEventImpersonatedRequest  = "impersonated_request"
+)
+
+// Outcomes of an authentication event
+const (
+	AuthOutcomeSuccess = "success"
+	AuthOutcomeFailure = "failure"
+	AuthOutcomePending = "pending" // a second factor or enrollment is still required
+)
+
+// AuthEvent records an authentication or security relevant event of a user.
+// Events are append-only and are only removed when the account is purged.
+type AuthEvent struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"index"` // 0 when no account matched, e.g. a login with an unknown email
+	Type      string    `json:"type" gorm:"type:varchar(50);index"`
+	Outcome   string    `json:"outcome" gorm:"type:varchar(20)"`
+	IPAddress string    `json:"ip_address" gorm:"type:varchar(45)"`
+	UserAgent string    `json:"user_agent" gorm:"type:varchar(255)"`
+	Details   string    `json:"details" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
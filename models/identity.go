@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to their account at a social login provider
+type UserIdentity struct {
+	gorm.Model
+	UserID      uint       `json:"user_id" gorm:"index"`
+	Provider    string     `json:"provider" gorm:"type:varchar(50);uniqueIndex:idx_user_identities_provider_subject"`
+	Subject     string     `json:"subject" gorm:"type:varchar(255);uniqueIndex:idx_user_identities_provider_subject"` // the provider's user ID
+	Email       string     `json:"email" gorm:"type:varchar(255)"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// OIDCLoginState holds the state, nonce and PKCE verifier of a social login
+// between the redirect to the provider and the callback. It is deleted when
+// the callback uses it.
+type OIDCLoginState struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	Provider     string    `json:"provider" gorm:"type:varchar(50)"`
+	StateHash    string    `json:"-" gorm:"type:varchar(64);uniqueIndex"` // SHA-256 of the state parameter
+	Nonce        string    `json:"-" gorm:"type:varchar(64)"`
+	CodeVerifier string    `json:"-" gorm:"type:varchar(128)"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invitation lets people register while registration is invite-only. An
+// invitation is either bound to one email address or a code shared with
+// several people; only a hash of the code is stored.
+type Invitation struct {
+	gorm.Model
+	CodeHash  string     `json:"-" gorm:"type:varchar(64);uniqueIndex"` // SHA-256 of the invite code
+	Email     string     `json:"email" gorm:"type:varchar(255);index"`  // empty for codes anyone can use
+	Role      string     `json:"role" gorm:"type:varchar(50)"`          // role given to users registering with it
+	MaxUses   int        `json:"max_uses"`
+	UseCount  int        `json:"use_count"`
+	ExpiresAt *time.Time `json:"expires_at"` // nil for invitations that never expire
+	CreatedBy uint       `json:"created_by"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsActive reports whether the invitation can still be used
+func (i *Invitation) IsActive() bool {
+	return i.RevokedAt == nil && i.UseCount < i.MaxUses && (i.ExpiresAt == nil || time.Now().Before(*i.ExpiresAt))
+}
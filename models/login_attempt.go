@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LoginAttempt tracks failed logins for a key such as an email address or IP,
+// used when login counters are shared between instances
+type LoginAttempt struct {
+	gorm.Model
+	Key           string    `json:"key" gorm:"type:varchar(255);uniqueIndex"`
+	Failures      int       `json:"failures" gorm:"default:0"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Passkey ceremonies a challenge can be used for
+const (
+	PasskeyChallengeRegistration = "registration"
+	PasskeyChallengeLogin        = "login"
+)
+
+// Passkey is a WebAuthn credential a user registered for logging in without a password
+type Passkey struct {
+	gorm.Model
+	UserID       uint       `json:"user_id" gorm:"index"`
+	CredentialID string     `json:"credential_id" gorm:"type:varchar(255);uniqueIndex"` // base64url, as sent by the browser
+	PublicKey    []byte     `json:"-" gorm:"type:blob"`                                 // COSE encoded
+	Algorithm    int        `json:"algorithm"`                                          // COSE algorithm of the key
+	SignCount    uint32     `json:"sign_count"`
+	Transports   string     `json:"-" gorm:"type:varchar(100)"` // comma separated hints such as usb, internal or hybrid
+	AAGUID       string     `json:"aaguid" gorm:"type:varchar(36)"`
+	Nickname     string     `json:"nickname" gorm:"type:varchar(100)"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+// TransportList returns the transports reported by the authenticator
+func (p *Passkey) TransportList() []string {
+	if p.Transports == "" {
+		return []string{}
+	}
+	return strings.Split(p.Transports, ",")
+}
+
+// PasskeyChallenge holds the challenge of a passkey ceremony until the browser
+// answers it. It is deleted when used.
+type PasskeyChallenge struct {
+	ID            uint      `json:"id" gorm:"primarykey"`
+	UserID        uint      `json:"user_id" gorm:"index"`            // 0 for logins, the user is only known from the answer
+	Purpose       string    `json:"purpose" gorm:"type:varchar(20)"` // registration or login
+	ChallengeHash string    `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	ExpiresAt     time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -22,4 +22,20 @@ type Project struct {
 	YoutubeLink  string `json:"youtube_link" gorm:"type:varchar(255)"`
 	GithubLink   string `json:"github_link" gorm:"type:varchar(255)"`
 	InstaLink    string `json:"insta_link" gorm:"type:varchar(255)"`
+
+	OwnerID *uint         `json:"owner_id" gorm:"index"` // nil for projects created before ownership existed
+	Owner   *ProjectOwner `json:"owner,omitempty" gorm:"foreignKey:OwnerID"`
+}
+
+// ProjectOwner is the public profile of a project's owner
+type ProjectOwner struct {
+	ID           uint   `json:"id"`
+	Name         string `json:"name"`
+	Surname      string `json:"surname"`
+	ProfileImage string `json:"profile_image,omitempty"`
+}
+
+// TableName maps ProjectOwner to the users table
+func (ProjectOwner) TableName() string {
+	return "users"
 }
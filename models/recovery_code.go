@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode represents a single-use code that replaces a TOTP code when the
+// user has lost their authenticator
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `json:"user_id" gorm:"index"`
+	CodeHash string     `json:"-" gorm:"type:varchar(64)"` // SHA-256 of the normalized code
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
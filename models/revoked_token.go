@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RevokedToken represents an access token that was revoked before it expired
+type RevokedToken struct {
+	gorm.Model
+	JTI       string    `json:"jti" gorm:"column:jti;type:varchar(64);uniqueIndex"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"` // the row can be pruned once the token has expired
+}
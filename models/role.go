@@ -0,0 +1,48 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Built-in roles
+const (
+	RoleAdmin = "admin" // always holds every permission
+	RoleUser  = "user"  // default role of new accounts
+)
+
+// Permissions checked by the API
+const (
+	PermissionProjectsWrite    = "projects:write" // edit and delete any project
+	PermissionCrewWrite        = "crew:write"
+	PermissionUsersManage      = "users:manage"
+	PermissionUsersImpersonate = "users:impersonate" // act as another user to see what they see
+	PermissionRolesManage      = "roles:manage"      // manage roles and assign them to users
+)
+
+// PrivilegedPermissions give power over other people's accounts. With
+// MFA_REQUIRED_FOR_ADMIN, roles holding any of them must use two-factor authentication.
+var PrivilegedPermissions = []string{PermissionUsersManage, PermissionUsersImpersonate, PermissionRolesManage}
+
+// DefaultPermissions lists the permissions created by the migrations
+var DefaultPermissions = map[string]string{
+	PermissionProjectsWrite:    "Edit and delete any project",
+	PermissionCrewWrite:        "Create, update and delete crew members",
+	PermissionUsersManage:      "View and manage user accounts",
+	PermissionUsersImpersonate: "Act as another user to see what they see",
+	PermissionRolesManage:      "Manage roles and assign them to users",
+}
+
+// Permission represents a single action a role may be allowed to perform
+type Permission struct {
+	gorm.Model
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+}
+
+// Role represents a named set of permissions. Users reference their role by name.
+type Role struct {
+	gorm.Model
+	Name        string       `json:"name" gorm:"type:varchar(20);uniqueIndex"`
+	Description string       `json:"description" gorm:"type:varchar(255)"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxUserAgentLength is the size of the user_agent columns of sessions and auth events
+const MaxUserAgentLength = 255
+
+// Session represents a logged-in device of a user. It is the family that all
+// refresh tokens issued by rotation from the login belong to.
+type Session struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"index"`
+	UserAgent  string     `json:"user_agent" gorm:"type:varchar(255)"`
+	IPAddress  string     `json:"ip_address" gorm:"type:varchar(45)"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"` // absolute lifetime of the token family
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsActive reports whether the session can still be used to refresh tokens
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RefreshToken represents a single refresh token of a session. Rotated tokens
+// are kept so that a replayed token can be detected.
+type RefreshToken struct {
+	gorm.Model
+	SessionID uint       `json:"session_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);uniqueIndex"` // SHA-256 of the token
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+}
+
+// IsRotated reports whether the token was already exchanged for a new one
+func (t *RefreshToken) IsRotated() bool {
+	return t.RotatedAt != nil
+}
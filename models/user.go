@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -10,6 +12,7 @@ type User struct {
 	Name           string `json:"name" gorm:"type:varchar(100)"`
 	Surname        string `json:"surname" gorm:"type:varchar(100)"`
 	Email          string `json:"email" gorm:"type:varchar(255);uniqueIndex"`
+	PendingEmail   string `json:"pending_email,omitempty" gorm:"type:varchar(255)"`
 	Password       string `json:"-" gorm:"type:varchar(255)"` // Password is not exposed in JSON
 	ProfileImage   string `json:"profile_image,omitempty" gorm:"type:varchar(255)"`
 	CompanyName    string `json:"company_name,omitempty" gorm:"type:varchar(100)"`
@@ -18,7 +21,32 @@ type User struct {
 	CompanyPhone   string `json:"company_phone,omitempty" gorm:"type:varchar(20)"`
 	Position       string `json:"position,omitempty" gorm:"type:varchar(100)"`
 	ReferralSource string `json:"referral_source,omitempty" gorm:"type:varchar(100)"`
-	Role           string `json:"role" gorm:"type:varchar(20);default:'user'"` // 'admin' or 'user'
-	RefreshToken   string `json:"-" gorm:"type:varchar(255)"`
+	Role           string `json:"role" gorm:"type:varchar(20);default:'user'"` // name of the user's role
+	Status         string `json:"status" gorm:"type:varchar(20);default:'active';index"`
 	ResumeFile     string `json:"resume_file,omitempty" gorm:"type:varchar(255)"`
+
+	EmailVerifiedAt  *time.Time `json:"email_verified_at,omitempty"` // nil until the email address is confirmed
+	TokensValidAfter *time.Time `json:"-"`                           // access tokens issued up to this time are rejected
+
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at,omitempty"` // set when the user deleted their own account
+	AnonymizedAt        *time.Time `json:"anonymized_at,omitempty"`         // set once personal data was purged
+
+	TOTPSecret       string     `json:"-" gorm:"column:totp_secret;type:varchar(64)"`
+	TOTPEnabledAt    *time.Time `json:"-" gorm:"column:totp_enabled_at"` // nil until 2FA enrollment is confirmed
+	TOTPLastUsedStep int64      `json:"-" gorm:"column:totp_last_used_step;default:0"`
+}
+
+// IsTOTPEnabled reports whether the user has confirmed two-factor authentication
+func (u *User) IsTOTPEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// IsSuspended reports whether an admin has suspended the account
+func (u *User) IsSuspended() bool {
+	return u.Status == UserStatusSuspended
+}
+
+// IsEmailVerified reports whether the user has confirmed their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// Account statuses
+const (
+	UserStatusPending   = "pending"   // registered, email address not verified yet
+	UserStatusActive    = "active"    // can log in
+	UserStatusSuspended = "suspended" // blocked by an admin
+	UserStatusDeleted   = "deleted"   // soft-deleted, can be restored
+)
+
+// userStatusTransitions lists the statuses each status may change to
+var userStatusTransitions = map[string][]string{
+	UserStatusPending:   {UserStatusActive, UserStatusDeleted},
+	UserStatusActive:    {UserStatusSuspended, UserStatusDeleted},
+	UserStatusSuspended: {UserStatusActive, UserStatusDeleted},
+	UserStatusDeleted:   {UserStatusActive},
+}
+
+// IsValidUserStatus reports whether status is one of the known account statuses
+func IsValidUserStatus(status string) bool {
+	_, ok := userStatusTransitions[status]
+	return ok
+}
+
+// CanTransitionUserStatus reports whether an account may move from one status to another
+func CanTransitionUserStatus(from, to string) bool {
+	for _, allowed := range userStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// UserStatusChange records a change of a user's account status, who made it and why
+type UserStatusChange struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	UserID     uint      `json:"user_id" gorm:"index"`
+	FromStatus string    `json:"from_status" gorm:"type:varchar(20)"`
+	ToStatus   string    `json:"to_status" gorm:"type:varchar(20)"`
+	ChangedBy  *uint     `json:"changed_by"` // nil when changed by the system
+	Reason     string    `json:"reason" gorm:"type:varchar(500)"`
+	CreatedAt  time.Time `json:"created_at"`
+}
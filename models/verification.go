@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Verification code purposes
+const (
+	VerificationPurposeEmail         = "email_verification"
+	VerificationPurposePasswordReset = "password_reset"
+	VerificationPurposeEmailChange   = "email_change"
+)
+
+// VerificationCode represents a one-time code sent to a user by email
+type VerificationCode struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Purpose    string     `json:"purpose" gorm:"type:varchar(32);index"`
+	CodeHash   string     `json:"-" gorm:"type:varchar(64)"` // SHA-256 of the code, the code itself is never stored
+	Attempts   int        `json:"attempts" gorm:"default:0"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+}
@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/controllers"
+	"ambridge-backend/middleware"
+	"ambridge-backend/models"
+)
+
+// SetupAdminRoutes configures the user administration routes
+func SetupAdminRoutes(router *gin.Engine) {
+	admin := router.Group("/admin")
+	// Admin actions are never taken with an impersonation token, so the audit
+	// trail always names the admin who took them
+	admin.Use(middleware.AuthMiddleware(), middleware.RejectImpersonation())
+	{
+		users := admin.Group("/users")
+		users.Use(middleware.RequirePermission(models.PermissionUsersManage))
+		{
+			users.GET("", controllers.ListUsers)
+			users.GET("/:id", controllers.GetUser)
+			users.DELETE("/:id", controllers.DeleteUser)
+			users.POST("/:id/restore", controllers.RestoreUser)
+			users.POST("/:id/suspend", controllers.SuspendUser)
+			users.POST("/:id/reactivate", controllers.ReactivateUser)
+			users.POST("/:id/logout", controllers.ForceLogoutUser)
+			users.POST("/:id/unlock", controllers.UnlockUser)
+			users.PUT("/:id/status", controllers.UpdateUserStatus)
+			users.GET("/:id/status-history", controllers.GetUserStatusHistory)
+			users.GET("/:id/activity", controllers.GetUserActivity)
+		}
+
+		// Impersonation needs its own permission and a real admin session
+		admin.POST("/users/:id/impersonate",
+			middleware.RequirePermission(models.PermissionUsersImpersonate),
+			middleware.RejectAPIKeys(),
+			controllers.ImpersonateUser,
+		)
+
+		admin.GET("/auth-events", middleware.RequirePermission(models.PermissionUsersManage), controllers.ListAuthEvents)
+
+		invitations := admin.Group("/invitations")
+		invitations.Use(middleware.RequirePermission(models.PermissionUsersManage))
+		{
+			invitations.GET("", controllers.ListInvitations)
+			invitations.POST("", controllers.CreateInvitation)
+			invitations.DELETE("/:id", controllers.RevokeInvitation)
+		}
+
+		roles := admin.Group("/")
+		roles.Use(middleware.RequirePermission(models.PermissionRolesManage))
+		{
+			roles.GET("/roles", controllers.ListRoles)
+			roles.POST("/roles", controllers.CreateRole)
+			roles.PUT("/roles/:id", controllers.UpdateRole)
+			roles.GET("/permissions", controllers.ListPermissions)
+			roles.PUT("/users/:id/role", controllers.AssignRole)
+		}
+	}
+}
@@ -13,16 +13,64 @@ func SetupAuthRoutes(router *gin.Engine) {
 	{
 		auth.POST("/register", controllers.Register)
 		auth.POST("/login", controllers.Login)
+		auth.POST("/login/2fa", controllers.LoginMFA)
 		auth.POST("/refresh-token", controllers.RefreshToken)
+		auth.POST("/verify-email", controllers.VerifyEmail)
+		auth.POST("/resend-verification", controllers.ResendVerification)
+		auth.POST("/forgot-password", controllers.ForgotPassword)
+		auth.POST("/reset-password", controllers.ResetPassword)
+		auth.POST("/magic-link", controllers.RequestMagicLink)
+		auth.POST("/magic-link/consume", controllers.ConsumeMagicLink)
+		auth.POST("/passkeys/login/options", controllers.StartPasskeyLogin)
+		auth.POST("/passkeys/login", controllers.FinishPasskeyLogin)
 
-		// Protected routes
+		// Social login
+		auth.GET("/oidc/providers", controllers.ListOIDCProviders)
+		auth.POST("/oidc/:provider/authorize", controllers.StartOIDCLogin)
+		auth.POST("/oidc/:provider/callback", controllers.CompleteOIDCLogin)
+
+		// Two-factor enrollment also accepts the enrollment token returned by login
+		mfaEnrollment := auth.Group("/2fa")
+		mfaEnrollment.Use(middleware.MFAEnrollmentMiddleware())
+		{
+			mfaEnrollment.POST("/enroll", controllers.EnrollTOTP)
+			mfaEnrollment.POST("/confirm", controllers.ConfirmTOTP)
+		}
+
+		// Protected routes, not available to API keys
 		authRequired := auth.Group("/")
-		authRequired.Use(middleware.AuthMiddleware())
+		authRequired.Use(middleware.AuthMiddleware(), middleware.RejectAPIKeys())
 		{
 			authRequired.POST("/logout", controllers.Logout)
 			authRequired.GET("/profile", controllers.GetProfile)
 			authRequired.PATCH("/profile", controllers.UpdateProfile)
 			authRequired.POST("/check-admin", controllers.IsAdmin)
+			authRequired.GET("/sessions", controllers.ListSessions)
+			authRequired.GET("/api-keys", controllers.ListAPIKeys)
+			authRequired.GET("/identities", controllers.ListIdentities)
+			authRequired.GET("/passkeys", controllers.ListPasskeys)
+			authRequired.GET("/activity", controllers.GetActivity)
+
+			// Sensitive actions, not available to admins impersonating the user
+			sensitive := authRequired.Group("/")
+			sensitive.Use(middleware.RejectImpersonation())
+			{
+				sensitive.POST("/change-password", controllers.ChangePassword)
+				sensitive.POST("/change-email", controllers.ChangeEmail)
+				sensitive.POST("/change-email/confirm", controllers.ConfirmEmailChange)
+				sensitive.DELETE("/account", controllers.DeleteAccount)
+				sensitive.GET("/export", controllers.ExportAccount)
+				sensitive.DELETE("/sessions", controllers.RevokeOtherSessions)
+				sensitive.DELETE("/sessions/:id", controllers.RevokeSession)
+				sensitive.POST("/2fa/disable", controllers.DisableTOTP)
+				sensitive.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+				sensitive.POST("/api-keys", controllers.CreateAPIKey)
+				sensitive.DELETE("/api-keys/:id", controllers.RevokeAPIKey)
+				sensitive.DELETE("/identities/:id", controllers.UnlinkIdentity)
+				sensitive.POST("/passkeys/register/options", controllers.StartPasskeyRegistration)
+				sensitive.POST("/passkeys/register", controllers.FinishPasskeyRegistration)
+				sensitive.DELETE("/passkeys/:id", controllers.DeletePasskey)
+			}
 		}
 	}
 }
@@ -5,6 +5,7 @@ import (
 
 	"ambridge-backend/controllers"
 	"ambridge-backend/middleware"
+	"ambridge-backend/models"
 )
 
 // SetupCrewRoutes configures the crew routes
@@ -15,11 +16,9 @@ func SetupCrewRoutes(router *gin.Engine) {
 		crew.GET("", controllers.GetAllCrewMembers)
 		crew.GET("/:id", controllers.GetCrewMember)
 
-		// Protected routes (require authentication)
-		// Only admins can create, update, or delete crew members
-		// The admin check is done in the controller
+		// Protected routes (require the crew:write permission)
 		authRequired := crew.Group("/")
-		authRequired.Use(middleware.AuthMiddleware())
+		authRequired.Use(middleware.AuthMiddleware(), middleware.RequirePermission(models.PermissionCrewWrite))
 		{
 			authRequired.POST("", controllers.CreateCrew)
 			authRequired.PUT("/:id", controllers.UpdateCrewMember)
@@ -5,19 +5,22 @@ import (
 
 	"ambridge-backend/controllers"
 	"ambridge-backend/middleware"
+	"ambridge-backend/models"
 )
 
 // SetupProjectRoutes configures the project routes
 func SetupProjectRoutes(router *gin.Engine) {
 	project := router.Group("/projects")
 	{
-		// Public routes
-		project.GET("", controllers.GetAllProjects)
+		// Public routes, a token is only needed for ?owner=me
+		project.GET("", middleware.OptionalAuthMiddleware(), controllers.GetAllProjects)
 		project.GET("/:id", controllers.GetProject)
 
 		// Protected routes (require authentication)
+		// Projects can only be modified by their owner or with the projects:write permission,
+		// API keys additionally need the projects:write scope
 		authRequired := project.Group("/")
-		authRequired.Use(middleware.AuthMiddleware())
+		authRequired.Use(middleware.AuthMiddleware(), middleware.RequireScope(models.PermissionProjectsWrite))
 		{
 			authRequired.POST("", controllers.CreateProject)
 			authRequired.PUT("/:id", controllers.UpdateProject)
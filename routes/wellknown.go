@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"ambridge-backend/controllers"
+)
+
+// SetupWellKnownRoutes configures the /.well-known discovery routes
+func SetupWellKnownRoutes(router *gin.Engine) {
+	wellKnown := router.Group("/.well-known")
+	{
+		wellKnown.GET("/jwks.json", controllers.JWKS)
+	}
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+)
+
+// StartAccountSweeper periodically purges accounts whose deletion grace period has passed
+func StartAccountSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			PurgeDeletedAccounts()
+		}
+	}()
+}
+
+// PurgeDeletedAccounts anonymises users who deleted their own account more than
+// ACCOUNT_DELETION_GRACE_PERIOD days ago and removes the data linked to them
+func PurgeDeletedAccounts() {
+	cutoff := time.Now().AddDate(0, 0, -config.GetAccountDeletionGracePeriod())
+
+	var users []models.User
+	err := database.DB.Unscoped().
+		Where("status = ? AND deletion_requested_at < ? AND anonymized_at IS NULL", models.UserStatusDeleted, cutoff).
+		Find(&users).Error
+	if err != nil {
+		log.Printf("Failed to look up accounts to purge: %v", err)
+		return
+	}
+
+	for i := range users {
+		if err := purgeAccount(&users[i]); err != nil {
+			log.Printf("Failed to purge account of user %d: %v", users[i].ID, err)
+		}
+	}
+}
+
+// purgeAccount replaces the personal data of a user with placeholders and hard
+// deletes their sessions, codes, API keys, linked identities and auth events, including
+// those that only name their email address. The row itself is kept so
+// that status history and project ownership still resolve.
+func purgeAccount(user *models.User) error {
+	email := user.Email
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var sessionIDs []uint
+		if err := tx.Unscoped().Model(&models.Session{}).Where("user_id = ?", user.ID).Pluck("id", &sessionIDs).Error; err != nil {
+			return err
+		}
+		if len(sessionIDs) > 0 {
+			if err := tx.Unscoped().Where("session_id IN ?", sessionIDs).Delete(&models.RefreshToken{}).Error; err != nil {
+				return err
+			}
+		}
+
+		linked := []interface{}{
+			&models.Session{},
+			&models.VerificationCode{},
+			&models.RecoveryCode{},
+			&models.RevokedToken{},
+			&models.AuthEvent{},
+			&models.APIKey{},
+			&models.UserIdentity{},
+			&models.Passkey{},
+			&models.PasskeyChallenge{},
+		}
+		for _, model := range linked {
+			if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		// Events recorded before the account existed or while it was locked refer to its address instead
+		err := tx.Unscoped().
+			Where("user_id = 0 AND details LIKE ?", "%"+EmailReference(email)+"%").
+			Delete(&models.AuthEvent{}).Error
+		if err != nil {
+			return err
+		}
+
+		// An empty password hash never matches, so the account cannot be logged into
+		return tx.Unscoped().Model(user).Updates(map[string]interface{}{
+			"name":                "Deleted",
+			"surname":             "User",
+			"email":               fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+			"pending_email":       "",
+			"password":            "",
+			"profile_image":       "",
+			"company_name":        "",
+			"company_email":       "",
+			"company_address":     "",
+			"company_phone":       "",
+			"position":            "",
+			"referral_source":     "",
+			"resume_file":         "",
+			"totp_secret":         "",
+			"totp_enabled_at":     nil,
+			"totp_last_used_step": 0,
+			"anonymized_at":       time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// Failed logins are keyed by the old email address
+	if err := Attempts().Reset("email:" + email); err != nil {
+		log.Printf("Failed to clear login attempts of purged user %d: %v", user.ID, err)
+	}
+	return nil
+}
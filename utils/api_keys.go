@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+)
+
+// apiKeyLastUsedResolution limits how often the last-used timestamp of a key is written
+const apiKeyLastUsedResolution = time.Minute
+
+// ErrInvalidAPIKey is returned for unknown, malformed, revoked or expired API keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// GenerateAPIKey creates a new API key of the form amb_<prefix>_<secret> and
+// returns the key together with its public prefix
+func GenerateAPIKey() (string, string, error) {
+	prefix := make([]byte, 6)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	public := models.APIKeyPrefix + hex.EncodeToString(prefix)
+	return public + "_" + hex.EncodeToString(secret), public, nil
+}
+
+// AuthenticateAPIKey looks up an API key and returns it together with the
+// current role of its owner
+func AuthenticateAPIKey(key string) (*models.APIKey, string, error) {
+	// The public part is amb_ followed by 12 hex characters
+	separator := strings.LastIndexByte(key, '_')
+	if !strings.HasPrefix(key, models.APIKeyPrefix) || separator <= len(models.APIKeyPrefix) {
+		return nil, "", ErrInvalidAPIKey
+	}
+
+	var apiKey models.APIKey
+	if err := database.DB.Where("prefix = ?", key[:separator]).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrInvalidAPIKey
+		}
+		return nil, "", err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.SecretHash), []byte(HashToken(key))) != 1 || !apiKey.IsActive() {
+		return nil, "", ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "role").First(&user, apiKey.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrInvalidAPIKey
+		}
+		return nil, "", err
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyLastUsedResolution {
+		if err := database.DB.Model(&apiKey).UpdateColumn("last_used_at", now).Error; err != nil {
+			log.Printf("Failed to record use of API key %d: %v", apiKey.ID, err)
+		}
+	}
+
+	return &apiKey, user.Role, nil
+}
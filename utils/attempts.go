@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+)
+
+// attemptMemory is how long failed attempts are remembered after the last one
+const attemptMemory = 24 * time.Hour
+
+// LoginAttempts is the failed login state of a key
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// AttemptStore keeps failed login counters. The in-memory store suits a single
+// instance; DatabaseAttemptStore shares counters between instances.
+type AttemptStore interface {
+	Get(key string) (LoginAttempts, error)
+	RecordFailure(key string) (LoginAttempts, error)
+	Reset(key string) error
+}
+
+var (
+	attemptStore     AttemptStore
+	attemptStoreOnce sync.Once
+)
+
+// Attempts returns the store selected by LOGIN_ATTEMPT_STORE
+func Attempts() AttemptStore {
+	attemptStoreOnce.Do(func() {
+		if attemptStore != nil {
+			return
+		}
+		if config.GetLoginAttemptStore() == "database" {
+			attemptStore = &DatabaseAttemptStore{}
+		} else {
+			attemptStore = NewMemoryAttemptStore()
+		}
+	})
+	return attemptStore
+}
+
+// SetAttemptStore replaces the attempt store, e.g. with a shared cache implementation
+func SetAttemptStore(store AttemptStore) {
+	attemptStoreOnce.Do(func() {})
+	attemptStore = store
+}
+
+// LoginBlockedUntil returns the time until which further login attempts are
+// refused. The delay doubles with every failure starting at LOGIN_BACKOFF_BASE
+// seconds; after maxFailures the key is locked for LOGIN_LOCKOUT_DURATION minutes.
+func LoginBlockedUntil(attempts LoginAttempts, maxFailures int) time.Time {
+	if attempts.Failures == 0 {
+		return time.Time{}
+	}
+
+	lockout := time.Duration(config.GetLoginLockoutDuration()) * time.Minute
+	if attempts.Failures >= maxFailures {
+		return attempts.LastFailure.Add(lockout)
+	}
+
+	base := time.Duration(config.GetLoginBackoffBase()) * time.Second
+	delay := time.Duration(float64(base) * math.Pow(2, float64(attempts.Failures-1)))
+	if delay > lockout {
+		delay = lockout
+	}
+	return attempts.LastFailure.Add(delay)
+}
+
+// MemoryAttemptStore keeps failed login counters in process memory
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempts
+}
+
+// NewMemoryAttemptStore creates an empty in-memory attempt store
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]LoginAttempts)}
+}
+
+// Get returns the failed attempts of a key
+func (s *MemoryAttemptStore) Get(key string) (LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := s.attempts[key]
+	if time.Since(attempts.LastFailure) > attemptMemory {
+		delete(s.attempts, key)
+		return LoginAttempts{}, nil
+	}
+	return attempts, nil
+}
+
+// RecordFailure increments the failed attempts of a key
+func (s *MemoryAttemptStore) RecordFailure(key string) (LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	attempts := s.attempts[key]
+	if now.Sub(attempts.LastFailure) > attemptMemory {
+		attempts = LoginAttempts{}
+	}
+	attempts.Failures++
+	attempts.LastFailure = now
+	s.attempts[key] = attempts
+
+	// Drop stale keys now and then so the map does not grow forever
+	if len(s.attempts)%1024 == 0 {
+		for k, a := range s.attempts {
+			if now.Sub(a.LastFailure) > attemptMemory {
+				delete(s.attempts, k)
+			}
+		}
+	}
+
+	return attempts, nil
+}
+
+// Reset clears the failed attempts of a key
+func (s *MemoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// DatabaseAttemptStore keeps failed login counters in the login_attempts table
+type DatabaseAttemptStore struct{}
+
+// Get returns the failed attempts of a key
+func (s *DatabaseAttemptStore) Get(key string) (LoginAttempts, error) {
+	var record models.LoginAttempt
+	result := database.DB.Where("`key` = ?", key).First(&record)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return LoginAttempts{}, nil
+		}
+		return LoginAttempts{}, result.Error
+	}
+
+	if time.Since(record.LastFailureAt) > attemptMemory {
+		return LoginAttempts{}, nil
+	}
+	return LoginAttempts{Failures: record.Failures, LastFailure: record.LastFailureAt}, nil
+}
+
+// RecordFailure increments the failed attempts of a key
+func (s *DatabaseAttemptStore) RecordFailure(key string) (LoginAttempts, error) {
+	now := time.Now()
+	record := models.LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}
+
+	// Start counting again when the previous failures are too old to matter
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":        gorm.Expr("IF(last_failure_at < ?, 1, failures + 1)", now.Add(-attemptMemory)),
+			"last_failure_at": now,
+			"updated_at":      now,
+		}),
+	}).Create(&record).Error
+	if err != nil {
+		return LoginAttempts{}, err
+	}
+
+	return s.Get(key)
+}
+
+// Reset clears the failed attempts of a key
+func (s *DatabaseAttemptStore) Reset(key string) error {
+	return database.DB.Unscoped().Where("`key` = ?", key).Delete(&models.LoginAttempt{}).Error
+}
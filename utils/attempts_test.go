@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"ambridge-backend/config"
+)
+
+func TestLoginBlockedUntil(t *testing.T) {
+	withConfig(t, func(c *config.Config) {
+		c.LoginBackoffBase = 1
+		c.LoginLockoutDuration = 1
+	})
+	last := time.Now()
+
+	tests := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{7, time.Minute}, // the backoff never exceeds the lockout
+		{10, time.Minute},
+	}
+	for _, tt := range tests {
+		until := LoginBlockedUntil(LoginAttempts{Failures: tt.failures, LastFailure: last}, 10)
+		if tt.failures == 0 {
+			if !until.IsZero() {
+				t.Fatalf("Blocked without failures until %v", until)
+			}
+			continue
+		}
+		if delay := until.Sub(last); delay != tt.delay {
+			t.Fatalf("%d failures: expected a delay of %v, got %v", tt.failures, tt.delay, delay)
+		}
+	}
+}
+
+func TestMemoryAttemptStore(t *testing.T) {
+	store := NewMemoryAttemptStore()
+
+	for i := 1; i <= 3; i++ {
+		attempts, err := store.RecordFailure("email:a@example.com")
+		if err != nil || attempts.Failures != i {
+			t.Fatalf("Expected %d failures, got %d (%v)", i, attempts.Failures, err)
+		}
+	}
+	if attempts, _ := store.Get("email:b@example.com"); attempts.Failures != 0 {
+		t.Fatalf("Failures were counted for another key")
+	}
+
+	if err := store.Reset("email:a@example.com"); err != nil {
+		t.Fatalf("Failed to reset: %v", err)
+	}
+	if attempts, _ := store.Get("email:a@example.com"); attempts.Failures != 0 {
+		t.Fatalf("Failures remained after a reset")
+	}
+
+	// Failures are forgotten a day after the last one
+	store.attempts["ip:192.0.2.1"] = LoginAttempts{Failures: 5, LastFailure: time.Now().Add(-attemptMemory - time.Minute)}
+	if attempts, _ := store.Get("ip:192.0.2.1"); attempts.Failures != 0 {
+		t.Fatalf("Stale failures were kept")
+	}
+	store.attempts["ip:192.0.2.1"] = LoginAttempts{Failures: 5, LastFailure: time.Now().Add(-attemptMemory - time.Minute)}
+	if attempts, _ := store.RecordFailure("ip:192.0.2.1"); attempts.Failures != 1 {
+		t.Fatalf("Counting did not start again after stale failures, got %d", attempts.Failures)
+	}
+}
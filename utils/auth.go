@@ -2,49 +2,130 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	"ambridge-backend/config"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword creates a bcrypt hash of the password
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func init() {
+	// Issue times in milliseconds, so that tokens issued in the same second
+	// as a revocation can be told apart from those issued after it
+	jwt.TimePrecision = time.Millisecond
+}
+
+// GenerateJWT creates a new JWT token for a user session
+func GenerateJWT(userID uint, role string, sessionID uint) (string, error) {
+	// از تنظیمات جدید استفاده می‌کنیم
+	expHours := config.GetJWTExpiration()
+
+	claims, err := newClaims(userID, role, time.Hour*time.Duration(expHours)) // Token expires based on config
 	if err != nil {
 		return "", err
 	}
-	return string(hashedPassword), nil
+	claims.SessionID = sessionID
+
+	return signToken(claims)
 }
 
-// CheckPassword compares a bcrypt hashed password with its possible plaintext equivalent
-func CheckPassword(hashedPassword, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+// GeneratePurposeToken creates a short-lived token that can only be used for
+// the given purpose, never as an access token
+func GeneratePurposeToken(userID uint, role, purpose string, ttl time.Duration) (string, error) {
+	claims, err := newClaims(userID, role, ttl)
+	if err != nil {
+		return "", err
+	}
+	claims.Purpose = purpose
+
+	return signToken(claims)
 }
 
-// GenerateJWT creates a new JWT token for a user
-func GenerateJWT(userID uint, role string) (string, error) {
-	// از تنظیمات جدید استفاده می‌کنیم
-	expHours := config.GetJWTExpiration()
+// GenerateMagicLinkToken creates a login token for a magic link. The token is
+// bound to the email address it is sent to.
+func GenerateMagicLinkToken(userID uint, role, email string, ttl time.Duration) (string, error) {
+	claims, err := newClaims(userID, role, ttl)
+	if err != nil {
+		return "", err
+	}
+	claims.Purpose = TokenPurposeMagicLink
+	claims.Email = email
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"role":    role,
-		"exp":     time.Now().Add(time.Hour * time.Duration(expHours)).Unix(), // Token expires based on config
-	})
+	return signToken(claims)
+}
+
+// GenerateImpersonationToken creates a short-lived access token for the user
+// that carries the impersonating admin in its act claim. It belongs to no
+// session and cannot be refreshed.
+func GenerateImpersonationToken(userID uint, role string, actorID uint, ttl time.Duration) (string, *Claims, error) {
+	claims, err := newClaims(userID, role, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+	claims.Actor = &Actor{Subject: strconv.FormatUint(uint64(actorID), 10)}
+
+	token, err := signToken(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
 
-	tokenString, err := token.SignedString([]byte(config.GetJWTSecret()))
+// newClaims fills the registered claims for a token of the user
+func newClaims(userID uint, role string, ttl time.Duration) (*Claims, error) {
+	// Unique token ID used to revoke this token
+	jti, err := generateTokenID()
 	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			Issuer:    config.GetJWTIssuer(),
+			Audience:  jwt.ClaimStrings{config.GetJWTAudience()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        jti,
+		},
+		Role: role,
+	}, nil
+}
+
+// signToken signs the claims with the active key, or with JWT_SECRET when
+// asymmetric signing is not configured
+func signToken(claims jwt.Claims) (string, error) {
+	if !usesAsymmetricKeys() {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.GetJWTSecret()))
+	}
+
+	key, err := activeSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// generateTokenID creates a random identifier for the jti claim
+func generateTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	return hex.EncodeToString(b), nil
 }
 
 // GenerateRefreshToken creates a new refresh token
@@ -58,24 +139,52 @@ func GenerateRefreshToken() (string, error) {
 	return fmt.Sprintf("%x", b), nil
 }
 
-// VerifyJWT validates a JWT token
-func VerifyJWT(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(config.GetJWTSecret()), nil
-	})
+// VerifyJWT validates an access token, including its issuer and audience
+func VerifyJWT(tokenString string) (*Claims, error) {
+	return VerifyPurposeToken(tokenString, "")
+}
+
+// VerifyPurposeToken validates a token and checks that it was issued for the
+// given purpose; an empty purpose means an access token
+func VerifyPurposeToken(tokenString, purpose string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKeyFunc,
+		jwt.WithIssuer(config.GetJWTIssuer()),
+		jwt.WithAudience(config.GetJWTAudience()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if claims.Purpose != purpose {
+		return nil, errors.New("token was issued for another purpose")
+	}
+
+	return claims, nil
+}
+
+// verificationKeyFunc returns the key that verifies a token: JWT_SECRET for
+// HMAC signing, otherwise the public key matching the kid header
+func verificationKeyFunc(token *jwt.Token) (interface{}, error) {
+	if !usesAsymmetricKeys() {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(config.GetJWTSecret()), nil
 	}
 
-	return nil, errors.New("invalid token")
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("token has no key ID")
+	}
+	return verificationKey(kid, token.Method.Alg())
 }
 
 // GenerateOTP generates a random 6-digit OTP
@@ -90,3 +199,17 @@ func GenerateOTP() (string, error) {
 	// Format as a 6-digit string with leading zeros if necessary
 	return fmt.Sprintf("%06d", n), nil
 }
+
+// HashToken returns the hex encoded SHA-256 digest of a token, used to store
+// one-time codes and other secrets without keeping their plaintext value
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// EmailReference returns the pseudonym under which auth events without an
+// account refer to an email address. Admins can match a known address against
+// it, but the address itself is not stored.
+func EmailReference(email string) string {
+	return "email#" + HashToken(strings.ToLower(email))[:16]
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	value, rest, err := decodeCBOR([]byte{0xa2, 0x01, 0x02, 0x03, 0x26, 0x43, 'a', 'b', 'c'})
+	if err != nil {
+		t.Fatalf("Failed to decode map: %v", err)
+	}
+	entries, ok := value.(map[interface{}]interface{})
+	if !ok || entries[int64(1)] != int64(2) || entries[int64(3)] != int64(-7) {
+		t.Fatalf("Unexpected map %v", value)
+	}
+	if !bytes.Equal(rest, []byte{0x43, 'a', 'b', 'c'}) {
+		t.Fatalf("Unexpected rest %x", rest)
+	}
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x81}, cborMaxDepth+2)
+
+	tests := map[string][]byte{
+		"empty":               {},
+		"truncated string":    {0x45, 'a', 'b'},
+		"truncated argument":  {0x19, 0x01},
+		"truncated map":       {0xa2, 0x01, 0x02},
+		"oversized array":     {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"integer overflow":    {0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"indefinite length":   {0x5f, 0x41, 'a', 0xff},
+		"tag":                 {0xc0, 0x00},
+		"float":               {0xf9, 0x3c, 0x00},
+		"byte string map key": {0xa1, 0x41, 'a', 0x00},
+		"nested too deeply":   append(deep, 0x00),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(data); !errors.Is(err, errCBOR) {
+				t.Fatalf("Expected malformed CBOR error, got %v", err)
+			}
+		})
+	}
+}
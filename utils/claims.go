@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token purposes for short-lived tokens that are not access tokens
+const (
+	TokenPurposeMFA           = "mfa"            // password verified, waiting for the second factor
+	TokenPurposeMFAEnrollment = "mfa_enrollment" // password verified, 2FA must be set up first
+	TokenPurposeMagicLink     = "magic_link"     // emailed single-use login link
+)
+
+// Actor identifies the admin acting on behalf of the token's subject (RFC 8693 act claim)
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// Claims represents the claims carried by an access token
+type Claims struct {
+	jwt.RegisteredClaims
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid,omitempty"`
+	Purpose   string `json:"purpose,omitempty"` // empty for access tokens
+	Email     string `json:"email,omitempty"`   // address a magic link was sent to
+	Actor     *Actor `json:"act,omitempty"`     // set on impersonation tokens
+}
+
+// UserID returns the user ID stored in the subject claim
+func (c *Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return 0, errors.New("invalid subject claim")
+	}
+	return uint(id), nil
+}
+
+// ActorID returns the ID of the impersonating admin, if the token has an act claim
+func (c *Claims) ActorID() (uint, bool) {
+	if c.Actor == nil {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(c.Actor.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// Validate checks the application specific claims; it is called by the jwt
+// parser after the registered claims were validated
+func (c *Claims) Validate() error {
+	if _, err := c.UserID(); err != nil {
+		return err
+	}
+	if c.ID == "" {
+		return errors.New("missing jti claim")
+	}
+	if c.IssuedAt == nil {
+		return errors.New("missing iat claim")
+	}
+	if c.Role == "" {
+		return errors.New("missing role claim")
+	}
+	if _, ok := c.ActorID(); c.Actor != nil && !ok {
+		return errors.New("invalid act claim")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ambridge-backend/models"
+)
+
+// ErrInvalidInvitation is returned for unknown, revoked, expired or used up
+// invitations and for invitations bound to another email address
+var ErrInvalidInvitation = errors.New("invalid invitation")
+
+// GenerateInvitationCode creates a new random invite code
+func GenerateInvitationCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ConsumeInvitation uses up one registration of an invitation for the given
+// email address. Run it in the transaction that creates the user so that the
+// use is given back when the registration fails.
+func ConsumeInvitation(tx *gorm.DB, code, email string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := tx.Where("code_hash = ?", HashToken(strings.TrimSpace(code))).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+
+	if !invitation.IsActive() || (invitation.Email != "" && !strings.EqualFold(invitation.Email, email)) {
+		return nil, ErrInvalidInvitation
+	}
+
+	// The conditions are checked again by the update so that concurrent
+	// registrations cannot use the invitation more often than allowed
+	result := tx.Model(&models.Invitation{}).
+		Where("id = ? AND revoked_at IS NULL AND use_count < max_uses AND (expires_at IS NULL OR expires_at > ?)", invitation.ID, time.Now()).
+		Update("use_count", gorm.Expr("use_count + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidInvitation
+	}
+
+	invitation.UseCount++
+	return &invitation, nil
+}
@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"ambridge-backend/config"
+)
+
+// signingKey is a key pair loaded from JWT_KEYS_DIR. Keys whose private half
+// was removed can still verify tokens but never sign new ones.
+type signingKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+	CreatedAt time.Time // zero when the key ID does not start with a timestamp
+}
+
+// keyIDTimeLayout is the creation timestamp that key IDs start with, as
+// written by `make keys`. Key IDs sort in creation order because of it.
+const keyIDTimeLayout = "20060102150405"
+
+// keySet holds the active signing key and all keys accepted for verification
+type keySet struct {
+	mu     sync.RWMutex
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+var signingKeys = &keySet{keys: make(map[string]*signingKey)}
+
+// usesAsymmetricKeys reports whether tokens are signed with keys from disk
+// instead of the shared JWT_SECRET
+func usesAsymmetricKeys() bool {
+	return config.GetJWTAlgorithm() != jwt.SigningMethodHS256.Alg()
+}
+
+// LoadSigningKeys (re)loads the signing keys from JWT_KEYS_DIR. Every *.pem file
+// holds one PKCS#8/PKCS#1 private key or PKIX public key; the file name without
+// extension is used as the key ID (kid). Keys are ordered by their ID, never by
+// file times, so that every instance picks the same active key.
+func LoadSigningKeys() error {
+	if !usesAsymmetricKeys() {
+		return nil
+	}
+
+	dir := config.GetJWTKeysDir()
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey)
+	for _, file := range files {
+		key, err := loadKeyFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to load key %s: %w", file, err)
+		}
+		keys[key.ID] = key
+	}
+
+	active, err := selectActiveKey(keys)
+	if err != nil {
+		return err
+	}
+
+	signingKeys.mu.Lock()
+	signingKeys.active = active
+	signingKeys.keys = keys
+	signingKeys.mu.Unlock()
+
+	return nil
+}
+
+// StartKeyReloader periodically reloads the signing keys so that a rotation
+// only requires dropping a new key file into JWT_KEYS_DIR
+func StartKeyReloader(interval time.Duration) {
+	if !usesAsymmetricKeys() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := LoadSigningKeys(); err != nil {
+				log.Printf("Failed to reload signing keys, keeping the previous ones: %v", err)
+			}
+		}
+	}()
+}
+
+// loadKeyFile parses a PEM encoded key file
+func loadKeyFile(file string) (*signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &signingKey{ID: strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))}
+	if len(key.ID) >= len(keyIDTimeLayout) {
+		if createdAt, err := time.Parse(keyIDTimeLayout, key.ID[:len(keyIDTimeLayout)]); err == nil {
+			key.CreatedAt = createdAt
+		}
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		key.Private = signer
+		key.Public = signer.Public()
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Private = parsed
+		key.Public = parsed.Public()
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = parsed
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	switch key.Public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	return key, nil
+}
+
+// selectActiveKey picks the key used for signing: JWT_ACTIVE_KEY_ID when set,
+// otherwise the private key of the configured algorithm with the highest ID
+func selectActiveKey(keys map[string]*signingKey) (*signingKey, error) {
+	algorithm := config.GetJWTAlgorithm()
+
+	if id := config.GetJWTActiveKeyID(); id != "" {
+		key, ok := keys[id]
+		if !ok || key.Private == nil {
+			return nil, fmt.Errorf("active key %q not found or has no private key", id)
+		}
+		if key.Method.Alg() != algorithm {
+			return nil, fmt.Errorf("active key %q is not a %s key", id, algorithm)
+		}
+		return key, nil
+	}
+
+	candidates := make([]*signingKey, 0, len(keys))
+	for _, key := range keys {
+		if key.Private != nil && key.Method.Alg() == algorithm {
+			candidates = append(candidates, key)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no %s private key found in %s", algorithm, config.GetJWTKeysDir())
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ID > candidates[j].ID
+	})
+	return candidates[0], nil
+}
+
+// isAcceptedKey reports whether a non-active key may still verify tokens.
+// Keys newer than the active key are published ahead of a rotation; older keys
+// are accepted for JWT_KEY_GRACE_PERIOD hours after the active key was created.
+// Without a timestamp in the active key's ID that time is unknown, so older
+// keys stay accepted until their files are removed.
+func (s *keySet) isAcceptedKey(key *signingKey) bool {
+	if key == s.active || key.ID > s.active.ID || s.active.CreatedAt.IsZero() {
+		return true
+	}
+
+	grace := time.Duration(config.GetJWTKeyGracePeriod()) * time.Hour
+	return time.Now().Before(s.active.CreatedAt.Add(grace))
+}
+
+// activeSigningKey returns the key used to sign new tokens
+func activeSigningKey() (*signingKey, error) {
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+
+	if signingKeys.active == nil {
+		return nil, errors.New("signing keys are not loaded")
+	}
+	return signingKeys.active, nil
+}
+
+// verificationKey returns the public key for a kid if it is still accepted
+func verificationKey(kid string, alg string) (crypto.PublicKey, error) {
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+
+	key, ok := signingKeys.keys[kid]
+	if !ok || signingKeys.active == nil || !signingKeys.isAcceptedKey(key) {
+		return nil, fmt.Errorf("unknown or retired key %q", kid)
+	}
+	if key.Method.Alg() != alg {
+		return nil, fmt.Errorf("key %q does not match algorithm %s", kid, alg)
+	}
+	return key.Public, nil
+}
+
+// PublicJWKS returns the JSON Web Key Set of all keys that currently verify tokens
+func PublicJWKS() []map[string]string {
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+
+	jwks := make([]map[string]string, 0, len(signingKeys.keys))
+	if signingKeys.active == nil {
+		return jwks
+	}
+
+	for _, key := range signingKeys.keys {
+		if !signingKeys.isAcceptedKey(key) {
+			continue
+		}
+
+		jwk := map[string]string{
+			"kid": key.ID,
+			"use": "sig",
+			"alg": key.Method.Alg(),
+		}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks = append(jwks, jwk)
+	}
+
+	// Stable order for caches and clients
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i]["kid"] < jwks[j]["kid"] })
+	return jwks
+}
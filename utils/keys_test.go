@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"ambridge-backend/config"
+)
+
+// keyID returns a key ID created at the given time, as `make keys` names them
+func keyID(createdAt time.Time) string {
+	return createdAt.UTC().Format(keyIDTimeLayout) + "-ed25519"
+}
+
+// writeKey stores a new Ed25519 key pair in dir, or only its public half
+func writeKey(t *testing.T, dir, id string, private bool) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	block := &pem.Block{Type: "PUBLIC KEY"}
+	if private {
+		block.Type = "PRIVATE KEY"
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(priv)
+	} else {
+		block.Bytes, err = x509.MarshalPKIXPublicKey(pub)
+	}
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, id+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
+
+// useKeysDir signs tokens with the Ed25519 keys in dir for the rest of the test
+func useKeysDir(t *testing.T, dir string) {
+	t.Helper()
+
+	withConfig(t, func(c *config.Config) {
+		c.JWTAlgorithm = jwt.SigningMethodEdDSA.Alg()
+		c.JWTKeysDir = dir
+		c.JWTActiveKeyID = ""
+	})
+	if err := LoadSigningKeys(); err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+}
+
+// tokenKeyID returns the kid header of a token
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatalf("Failed to parse token: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// jwksKeyIDs returns the key IDs published in the JWKS
+func jwksKeyIDs() []string {
+	var ids []string
+	for _, jwk := range PublicJWKS() {
+		ids = append(ids, jwk["kid"])
+	}
+	return ids
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldID := keyID(time.Now().Add(-time.Hour))
+	newID := keyID(time.Now())
+	nextID := keyID(time.Now().Add(time.Hour))
+
+	writeKey(t, dir, oldID, true)
+	useKeysDir(t, dir)
+	oldToken, err := GenerateJWT(1, "user", 0)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if kid := tokenKeyID(t, oldToken); kid != oldID {
+		t.Fatalf("Token signed with key %q instead of %q", kid, oldID)
+	}
+
+	// The newest private key signs; the next key is only published ahead of its rotation
+	writeKey(t, dir, newID, true)
+	writeKey(t, dir, nextID, false)
+	if err := LoadSigningKeys(); err != nil {
+		t.Fatalf("Failed to reload keys: %v", err)
+	}
+	newToken, err := GenerateJWT(1, "user", 0)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if kid := tokenKeyID(t, newToken); kid != newID {
+		t.Fatalf("Token signed with key %q instead of %q", kid, newID)
+	}
+
+	// Tokens of the previous key verify during the grace period
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := VerifyJWT(token); err != nil {
+			t.Fatalf("Token was rejected during the grace period: %v", err)
+		}
+	}
+	if ids := jwksKeyIDs(); len(ids) != 3 || ids[0] != oldID || ids[1] != newID || ids[2] != nextID {
+		t.Fatalf("Unexpected JWKS key IDs %v", ids)
+	}
+
+	// Afterwards the previous key is retired and no longer published
+	withConfig(t, func(c *config.Config) { c.JWTKeyGracePeriod = 0 })
+	if _, err := VerifyJWT(oldToken); err == nil {
+		t.Fatalf("Token of a retired key was accepted")
+	}
+	if _, err := VerifyJWT(newToken); err != nil {
+		t.Fatalf("Token of the active key was rejected: %v", err)
+	}
+	if ids := jwksKeyIDs(); len(ids) != 2 || ids[0] != newID || ids[1] != nextID {
+		t.Fatalf("Unexpected JWKS key IDs after the grace period %v", ids)
+	}
+}
+
+func TestActiveKeyID(t *testing.T) {
+	dir := t.TempDir()
+	oldID := keyID(time.Now().Add(-time.Hour))
+	newID := keyID(time.Now())
+	writeKey(t, dir, oldID, true)
+	writeKey(t, dir, newID, true)
+	useKeysDir(t, dir)
+
+	// JWT_ACTIVE_KEY_ID rolls back to an older key
+	withConfig(t, func(c *config.Config) { c.JWTActiveKeyID = oldID })
+	if err := LoadSigningKeys(); err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	token, err := GenerateJWT(1, "user", 0)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if kid := tokenKeyID(t, token); kid != oldID {
+		t.Fatalf("Token signed with key %q instead of %q", kid, oldID)
+	}
+
+	// A key without its private half cannot become the active key
+	publicID := keyID(time.Now().Add(time.Hour))
+	writeKey(t, dir, publicID, false)
+	withConfig(t, func(c *config.Config) { c.JWTActiveKeyID = publicID })
+	if err := LoadSigningKeys(); err == nil {
+		t.Fatalf("A public key was accepted as the active key")
+	}
+}
+
+func TestTokenSignedWithForeignKeyIsRejected(t *testing.T) {
+	dir := t.TempDir()
+	id := keyID(time.Now())
+	writeKey(t, dir, id, true)
+	useKeysDir(t, dir)
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	claims, err := newClaims(1, "user", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create claims: %v", err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = id
+	forged, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	if _, err := VerifyJWT(forged); err == nil {
+		t.Fatalf("Token signed with another key was accepted")
+	}
+}
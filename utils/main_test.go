@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"os"
+	"testing"
+
+	"ambridge-backend/config"
+)
+
+// TestMain runs the utils tests with the default configuration
+func TestMain(m *testing.M) {
+	config.LoadConfig()
+	os.Exit(m.Run())
+}
+
+// withConfig changes the configuration for the rest of the test
+func withConfig(t *testing.T, change func(*config.Config)) {
+	t.Helper()
+
+	saved := *config.AppConfig
+	change(config.AppConfig)
+	t.Cleanup(func() { *config.AppConfig = saved })
+}
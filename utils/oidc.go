@@ -0,0 +1,530 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"ambridge-backend/config"
+)
+
+// oidcHTTPClient talks to the identity providers
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// oidcMetadataTTL is how long discovery documents and signing keys are cached
+const oidcMetadataTTL = time.Hour
+
+// ErrOIDCLogin is wrapped by every error caused by a provider response, as
+// opposed to network or configuration failures
+var ErrOIDCLogin = errors.New("social login failed")
+
+// OIDCIdentity is the account a user signed in with at a provider
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Picture       string
+}
+
+// OIDCProvider is a social login provider. OpenID Connect providers are
+// configured from their discovery document; other providers such as GitHub
+// implement the same flow on top of plain OAuth 2.0.
+type OIDCProvider interface {
+	// Name identifies the provider in URLs and linked identities
+	Name() string
+	// AuthCodeURL returns the URL the user is sent to for signing in
+	AuthCodeURL(ctx context.Context, redirectURL, state, nonce, codeChallenge string) (string, error)
+	// Identify redeems an authorization code and returns the signed in account.
+	// The nonce must be checked when the provider issues ID tokens.
+	Identify(ctx context.Context, redirectURL, code, codeVerifier, nonce string) (*OIDCIdentity, error)
+}
+
+var (
+	oidcProviders     map[string]OIDCProvider
+	oidcProvidersOnce sync.Once
+	oidcProvidersMu   sync.RWMutex
+)
+
+// GetOIDCProvider returns the provider with the given name
+func GetOIDCProvider(name string) (OIDCProvider, bool) {
+	loadOIDCProviders()
+
+	oidcProvidersMu.RLock()
+	defer oidcProvidersMu.RUnlock()
+	provider, ok := oidcProviders[name]
+	return provider, ok
+}
+
+// OIDCProviderNames returns the names of the configured providers
+func OIDCProviderNames() []string {
+	loadOIDCProviders()
+
+	oidcProvidersMu.RLock()
+	defer oidcProvidersMu.RUnlock()
+	names := make([]string, 0, len(oidcProviders))
+	for name := range oidcProviders {
+		names = append(names, name)
+	}
+	return names
+}
+
+// RegisterOIDCProvider adds a provider or replaces the configured one of the same name
+func RegisterOIDCProvider(provider OIDCProvider) {
+	loadOIDCProviders()
+
+	oidcProvidersMu.Lock()
+	defer oidcProvidersMu.Unlock()
+	oidcProviders[provider.Name()] = provider
+}
+
+// NewOIDCProvider creates a provider from its configuration
+func NewOIDCProvider(cfg config.OIDCProviderConfig) OIDCProvider {
+	if cfg.Type == "github" {
+		return newGitHubProvider(cfg)
+	}
+	return &openIDProvider{cfg: cfg}
+}
+
+// loadOIDCProviders creates the providers listed in OIDC_PROVIDERS on first use
+func loadOIDCProviders() {
+	oidcProvidersOnce.Do(func() {
+		oidcProviders = make(map[string]OIDCProvider)
+		for _, cfg := range config.GetOIDCProviders() {
+			oidcProviders[cfg.Name] = NewOIDCProvider(cfg)
+		}
+	})
+}
+
+// GeneratePKCE returns a random PKCE code verifier and its S256 code challenge
+func GeneratePKCE() (string, string, error) {
+	verifier, err := randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// GenerateOIDCState returns a random value for the state or nonce parameter
+func GenerateOIDCState() (string, error) {
+	return randomURLToken(32)
+}
+
+// randomURLToken returns n random bytes encoded for use in URLs
+func randomURLToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// authCodeURL adds the authorization request parameters to an authorization endpoint
+func authCodeURL(endpoint string, cfg config.OIDCProviderConfig, redirectURL, state, nonce, codeChallenge string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", cfg.ClientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("scope", strings.Join(cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	if nonce != "" {
+		query.Set("nonce", nonce)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// oidcTokenResponse is the token endpoint response of the authorization code grant
+type oidcTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode redeems an authorization code at the token endpoint
+func exchangeCode(ctx context.Context, endpoint string, cfg config.OIDCProviderConfig, redirectURL, code, codeVerifier string) (*oidcTokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token oidcTokenResponse
+	status, err := doJSON(req, &token)
+	if err != nil {
+		return nil, err
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("%w: token endpoint returned %s %s", ErrOIDCLogin, token.Error, token.ErrorDescription)
+	}
+	if status != http.StatusOK || token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: token endpoint returned status %d", ErrOIDCLogin, status)
+	}
+	return &token, nil
+}
+
+// getJSON fetches a JSON document, optionally with a bearer access token
+func getJSON(ctx context.Context, endpoint, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	status, err := doJSON(req, v)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: %s returned status %d", ErrOIDCLogin, endpoint, status)
+	}
+	return nil
+}
+
+// doJSON sends a request and decodes its JSON response body
+func doJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("%w: invalid JSON from %s", ErrOIDCLogin, req.URL.Host)
+	}
+	return resp.StatusCode, nil
+}
+
+// openIDProvider is an OpenID Connect provider configured by discovery
+type openIDProvider struct {
+	cfg config.OIDCProviderConfig
+
+	mu        sync.Mutex
+	metadata  *oidcMetadata
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// oidcMetadata holds the parts of the discovery document used for login
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcIDTokenClaims are the ID token claims used to identify the user
+type oidcIDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+}
+
+func (p *openIDProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *openIDProvider) AuthCodeURL(ctx context.Context, redirectURL, state, nonce, codeChallenge string) (string, error) {
+	metadata, _, err := p.discover(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	return authCodeURL(metadata.AuthorizationEndpoint, p.cfg, redirectURL, state, nonce, codeChallenge)
+}
+
+func (p *openIDProvider) Identify(ctx context.Context, redirectURL, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	metadata, _, err := p.discover(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := exchangeCode(ctx, metadata.TokenEndpoint, p.cfg, redirectURL, code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token returned", ErrOIDCLogin)
+	}
+
+	var claims oidcIDTokenClaims
+	_, err = jwt.ParseWithClaims(token.IDToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.signingKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ID token: %v", ErrOIDCLogin, err)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: ID token nonce does not match", ErrOIDCLogin)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: ID token has no subject", ErrOIDCLogin)
+	}
+
+	return &OIDCIdentity{
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: claims.EmailVerified,
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+		Picture:       claims.Picture,
+	}, nil
+}
+
+// discover returns the provider's discovery document and signing keys, fetching
+// them again when they are older than oidcMetadataTTL or refresh is set
+func (p *openIDProvider) discover(ctx context.Context, refresh bool) (*oidcMetadata, map[string]crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Refetching on an unknown key is limited to once a minute
+	if p.metadata != nil && time.Since(p.fetchedAt) < oidcMetadataTTL && (!refresh || time.Since(p.fetchedAt) < time.Minute) {
+		return p.metadata, p.keys, nil
+	}
+
+	issuer := strings.TrimSuffix(p.cfg.Issuer, "/")
+	var metadata oidcMetadata
+	if err := getJSON(ctx, issuer+"/.well-known/openid-configuration", "", &metadata); err != nil {
+		return nil, nil, err
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, nil, fmt.Errorf("%w: discovery document of %s names issuer %s", ErrOIDCLogin, issuer, metadata.Issuer)
+	}
+
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := getJSON(ctx, metadata.JWKSURI, "", &jwks); err != nil {
+		return nil, nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, raw := range jwks.Keys {
+		kid, key, err := parseJWK(raw)
+		if err != nil {
+			// Skip keys of unsupported types, e.g. encryption keys
+			continue
+		}
+		keys[kid] = key
+	}
+
+	p.metadata, p.keys, p.fetchedAt = &metadata, keys, time.Now()
+	return p.metadata, p.keys, nil
+}
+
+// signingKey returns the provider key with the given ID, refetching the key set
+// once when the provider rotated its keys
+func (p *openIDProvider) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	for _, refresh := range []bool{false, true} {
+		_, keys, err := p.discover(ctx, refresh)
+		if err != nil {
+			return nil, err
+		}
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		// Providers with a single key may leave out the key ID
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// parseJWK converts an RSA, EC or Ed25519 JSON Web Key into a public key
+func parseJWK(raw json.RawMessage) (string, crypto.PublicKey, error) {
+	var jwk struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", nil, errors.New("not a signing key")
+	}
+
+	decode := base64.RawURLEncoding.DecodeString
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return "", nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.Kid, &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return "", nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		return jwk.Kid, ed25519.PublicKey(x), nil
+	default:
+		return "", nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+}
+
+// gitHubProvider signs users in with GitHub, which does not issue ID tokens.
+// The account is read from the REST API with the access token instead.
+type gitHubProvider struct {
+	cfg config.OIDCProviderConfig
+}
+
+// newGitHubProvider fills in the github.com endpoints that are not configured
+func newGitHubProvider(cfg config.OIDCProviderConfig) *gitHubProvider {
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = "https://github.com/login/oauth/authorize"
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = "https://github.com/login/oauth/access_token"
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.github.com"
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	return &gitHubProvider{cfg: cfg}
+}
+
+func (p *gitHubProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *gitHubProvider) AuthCodeURL(_ context.Context, redirectURL, state, _, codeChallenge string) (string, error) {
+	return authCodeURL(p.cfg.AuthURL, p.cfg, redirectURL, state, "", codeChallenge)
+}
+
+func (p *gitHubProvider) Identify(ctx context.Context, redirectURL, code, codeVerifier, _ string) (*OIDCIdentity, error) {
+	token, err := exchangeCode(ctx, p.cfg.TokenURL, p.cfg, redirectURL, code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var account struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := getJSON(ctx, p.cfg.APIURL+"/user", token.AccessToken, &account); err != nil {
+		return nil, err
+	}
+	if account.ID == 0 {
+		return nil, fmt.Errorf("%w: GitHub returned no user ID", ErrOIDCLogin)
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.cfg.APIURL+"/user/emails", token.AccessToken, &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &OIDCIdentity{
+		Subject: strconv.FormatInt(account.ID, 10),
+		Picture: account.AvatarURL,
+	}
+	identity.GivenName, identity.FamilyName, _ = strings.Cut(account.Name, " ")
+	if identity.GivenName == "" {
+		identity.GivenName = account.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = strings.ToLower(email.Email)
+			identity.EmailVerified = email.Verified
+		}
+	}
+	return identity, nil
+}
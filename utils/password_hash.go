@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"ambridge-backend/config"
+)
+
+// Password hash algorithms of PASSWORD_HASH_ALGORITHM
+const (
+	PasswordHashBcrypt   = config.PasswordHashBcrypt
+	PasswordHashArgon2id = config.PasswordHashArgon2id
+)
+
+// Lengths of the argon2id salt and key in bytes
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// errUnknownPasswordHash is returned for stored hashes in no known format, such
+// as the empty hash of accounts without a password
+var errUnknownPasswordHash = errors.New("unknown password hash format")
+
+// argon2Params are the cost parameters of an argon2id hash
+type argon2Params struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// currentArgon2Params returns the argon2id parameters of the configuration
+func currentArgon2Params() argon2Params {
+	return argon2Params{
+		Memory:      uint32(config.GetPasswordArgon2Memory()),
+		Iterations:  uint32(config.GetPasswordArgon2Iterations()),
+		Parallelism: uint8(config.GetPasswordArgon2Parallelism()),
+	}
+}
+
+// HashPassword hashes the password with the configured algorithm. Hashes are
+// self-describing: bcrypt hashes start with $2a$ or $2b$, argon2id hashes use
+// the PHC string format $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+func HashPassword(password string) (string, error) {
+	if config.GetPasswordHashAlgorithm() == PasswordHashBcrypt {
+		return hashBcrypt(password)
+	}
+	return hashArgon2id(password)
+}
+
+// hashBcrypt hashes the password with bcrypt at the configured cost
+func hashBcrypt(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), config.GetPasswordBcryptCost())
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// hashArgon2id hashes the password with argon2id and the configured parameters
+func hashArgon2id(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	params := currentArgon2Params()
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// dummyPassword is hashed to give DummyPasswordCheck something to compare with
+const dummyPassword = "ambridge-dummy-password"
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// DummyPasswordCheck takes as long as CheckPassword, so that logins for unknown
+// emails cannot be told apart from wrong passwords by their response time
+func DummyPasswordCheck(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash = slowestDummyHash()
+	})
+	CheckPassword(dummyPasswordHash, password)
+}
+
+// slowestDummyHash hashes the dummy password with each algorithm and returns
+// the hash that takes longest to check. Accounts keep their bcrypt hashes until
+// their next login whatever PASSWORD_HASH_ALGORITHM says, so the dummy check
+// must cost as much as the slowest algorithm that can be stored, not only the
+// configured one.
+func slowestDummyHash() string {
+	var slowest string
+	var longest time.Duration
+	for _, hash := range []func(string) (string, error){hashBcrypt, hashArgon2id} {
+		hashedPassword, err := hash(dummyPassword)
+		if err != nil {
+			log.Printf("Failed to create dummy password hash: %v", err)
+			continue
+		}
+
+		start := time.Now()
+		CheckPassword(hashedPassword, dummyPassword)
+		if elapsed := time.Since(start); elapsed > longest {
+			slowest, longest = hashedPassword, elapsed
+		}
+	}
+	return slowest
+}
+
+// CheckPassword compares a hashed password with its possible plaintext
+// equivalent, recognising the algorithm from the hash. Empty or unknown
+// hashes never match.
+func CheckPassword(hashedPassword, password string) bool {
+	switch {
+	case isBcryptHash(hashedPassword):
+		return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		params, salt, key, err := parseArgon2Hash(hashedPassword)
+		if err != nil {
+			log.Printf("Failed to parse argon2id password hash: %v", err)
+			return false
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(computed, key) == 1
+	}
+	return false
+}
+
+// PasswordNeedsRehash reports whether a stored hash is weaker than the current
+// configuration and should be replaced once the plaintext is known. Hashes are
+// never downgraded from argon2id to bcrypt.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	switch {
+	case isBcryptHash(hashedPassword):
+		if config.GetPasswordHashAlgorithm() != PasswordHashBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hashedPassword))
+		return err == nil && cost < config.GetPasswordBcryptCost()
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		if config.GetPasswordHashAlgorithm() != PasswordHashArgon2id {
+			return false
+		}
+		params, _, key, err := parseArgon2Hash(hashedPassword)
+		if err != nil {
+			return false
+		}
+		current := currentArgon2Params()
+		return params.Memory < current.Memory || params.Iterations < current.Iterations ||
+			params.Parallelism < current.Parallelism || len(key) < argon2KeyLength
+	}
+	return false
+}
+
+// isBcryptHash reports whether the hash is in the modular crypt format of bcrypt
+func isBcryptHash(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$2a$") || strings.HasPrefix(hashedPassword, "$2b$") ||
+		strings.HasPrefix(hashedPassword, "$2y$")
+}
+
+// parseArgon2Hash splits an argon2id PHC string into its parameters, salt and key
+func parseArgon2Hash(hashedPassword string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != PasswordHashArgon2id {
+		return params, nil, nil, errUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errUnknownPasswordHash
+	}
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"ambridge-backend/config"
+)
+
+// withCheapHashes hashes with the given algorithm and the lowest costs for the rest of the test
+func withCheapHashes(t *testing.T, algorithm string) {
+	t.Helper()
+
+	withConfig(t, func(c *config.Config) {
+		c.PasswordHashAlgorithm = algorithm
+		c.PasswordBcryptCost = bcrypt.MinCost
+		c.PasswordArgon2Memory = 1024
+		c.PasswordArgon2Iterations = 1
+		c.PasswordArgon2Parallelism = 1
+	})
+}
+
+// mustHash hashes the password or fails the test
+func mustHash(t *testing.T, password string) string {
+	t.Helper()
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	return hashedPassword
+}
+
+func TestHashPassword(t *testing.T) {
+	tests := map[string]string{
+		PasswordHashArgon2id: "$argon2id$v=19$m=1024,t=1,p=1$",
+		PasswordHashBcrypt:   "$2a$04$",
+	}
+	for algorithm, prefix := range tests {
+		t.Run(algorithm, func(t *testing.T) {
+			withCheapHashes(t, algorithm)
+
+			hashedPassword := mustHash(t, "Correct-Password-1")
+			if !strings.HasPrefix(hashedPassword, prefix) {
+				t.Fatalf("Expected a hash starting with %q, got %q", prefix, hashedPassword)
+			}
+			if !CheckPassword(hashedPassword, "Correct-Password-1") {
+				t.Fatalf("Password does not match its hash")
+			}
+			if CheckPassword(hashedPassword, "Wrong-Password-1") {
+				t.Fatalf("Wrong password matches the hash")
+			}
+		})
+	}
+}
+
+func TestCheckPasswordRejectsUnknownHashes(t *testing.T) {
+	withCheapHashes(t, PasswordHashArgon2id)
+	parts := strings.Split(mustHash(t, "Password-1"), "$")
+
+	hashes := map[string]string{
+		"empty":            "",
+		"plaintext":        "Password-1",
+		"wrong version":    strings.Join([]string{"", parts[1], "v=16", parts[3], parts[4], parts[5]}, "$"),
+		"zero memory":      strings.Join([]string{"", parts[1], parts[2], "m=0,t=1,p=1", parts[4], parts[5]}, "$"),
+		"missing key":      strings.Join([]string{"", parts[1], parts[2], parts[3], parts[4], ""}, "$"),
+		"missing sections": strings.Join(parts[:4], "$"),
+	}
+	for name, hashedPassword := range hashes {
+		if CheckPassword(hashedPassword, "Password-1") {
+			t.Fatalf("%s hash matched", name)
+		}
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	withCheapHashes(t, PasswordHashBcrypt)
+	cheapBcrypt := mustHash(t, "Password-1")
+	withCheapHashes(t, PasswordHashArgon2id)
+	cheapArgon2 := mustHash(t, "Password-1")
+
+	tests := []struct {
+		name           string
+		hashedPassword string
+		change         func(*config.Config)
+		rehash         bool
+	}{
+		{"bcrypt while argon2id is configured", cheapBcrypt, func(c *config.Config) {}, true},
+		{"bcrypt at the configured cost", cheapBcrypt, func(c *config.Config) { c.PasswordHashAlgorithm = PasswordHashBcrypt }, false},
+		{"bcrypt below the configured cost", cheapBcrypt, func(c *config.Config) {
+			c.PasswordHashAlgorithm = PasswordHashBcrypt
+			c.PasswordBcryptCost = bcrypt.MinCost + 1
+		}, true},
+		{"argon2id with the configured parameters", cheapArgon2, func(c *config.Config) {}, false},
+		{"argon2id with less memory", cheapArgon2, func(c *config.Config) { c.PasswordArgon2Memory = 2048 }, true},
+		{"argon2id with fewer iterations", cheapArgon2, func(c *config.Config) { c.PasswordArgon2Iterations = 2 }, true},
+		{"argon2id with less parallelism", cheapArgon2, func(c *config.Config) { c.PasswordArgon2Parallelism = 2 }, true},
+		{"argon2id with stronger parameters", cheapArgon2, func(c *config.Config) { c.PasswordArgon2Memory = 512 }, false},
+		{"argon2id while bcrypt is configured", cheapArgon2, func(c *config.Config) { c.PasswordHashAlgorithm = PasswordHashBcrypt }, false},
+		{"no password", "", func(c *config.Config) {}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, tt.change)
+			if got := PasswordNeedsRehash(tt.hashedPassword); got != tt.rehash {
+				t.Fatalf("Expected rehash %v, got %v", tt.rehash, got)
+			}
+		})
+	}
+}
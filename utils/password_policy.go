@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"ambridge-backend/config"
+)
+
+// bcryptMaxLength is the number of password bytes bcrypt actually uses
+const bcryptMaxLength = 72
+
+// minPersonalInfoLength is the shortest name or email part checked against the password,
+// shorter values would reject too many unrelated passwords
+const minPersonalInfoLength = 3
+
+// PasswordViolation describes one password policy rule a password breaks
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Password policy rule names returned to clients
+const (
+	PasswordRuleMinLength    = "min_length"
+	PasswordRuleMaxLength    = "max_length"
+	PasswordRuleUpper        = "uppercase"
+	PasswordRuleLower        = "lowercase"
+	PasswordRuleDigit        = "digit"
+	PasswordRuleSymbol       = "symbol"
+	PasswordRulePersonalInfo = "personal_info"
+	PasswordRuleBreached     = "breached"
+)
+
+// ValidatePassword checks a password against the configured password policy and
+// returns every rule it breaks. personalInfo holds the user's email, name and
+// other values the password must not contain.
+func ValidatePassword(password string, personalInfo ...string) []PasswordViolation {
+	violations := []PasswordViolation{}
+
+	if minLength := config.GetPasswordMinLength(); len([]rune(password)) < minLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    PasswordRuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", minLength),
+		})
+	}
+
+	// bcrypt silently ignores the bytes after its limit, argon2id has none
+	maxLength := config.GetPasswordMaxLength()
+	if config.GetPasswordHashAlgorithm() == PasswordHashBcrypt && (maxLength <= 0 || maxLength > bcryptMaxLength) {
+		maxLength = bcryptMaxLength
+	}
+	if maxLength > 0 && len(password) > maxLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    PasswordRuleMaxLength,
+			Message: fmt.Sprintf("Password must be at most %d bytes long", maxLength),
+		})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if config.GetPasswordRequireUpper() && !hasUpper {
+		violations = append(violations, PasswordViolation{Rule: PasswordRuleUpper, Message: "Password must contain an uppercase letter"})
+	}
+	if config.GetPasswordRequireLower() && !hasLower {
+		violations = append(violations, PasswordViolation{Rule: PasswordRuleLower, Message: "Password must contain a lowercase letter"})
+	}
+	if config.GetPasswordRequireDigit() && !hasDigit {
+		violations = append(violations, PasswordViolation{Rule: PasswordRuleDigit, Message: "Password must contain a digit"})
+	}
+	if config.GetPasswordRequireSymbol() && !hasSymbol {
+		violations = append(violations, PasswordViolation{Rule: PasswordRuleSymbol, Message: "Password must contain a symbol"})
+	}
+
+	if config.GetPasswordDisallowPersonalInfo() && containsPersonalInfo(password, personalInfo) {
+		violations = append(violations, PasswordViolation{
+			Rule:    PasswordRulePersonalInfo,
+			Message: "Password must not contain your name or email address",
+		})
+	}
+
+	if IsBreachedPassword(password) {
+		violations = append(violations, PasswordViolation{
+			Rule:    PasswordRuleBreached,
+			Message: "Password has appeared in a data breach, please choose a different one",
+		})
+	}
+
+	return violations
+}
+
+// containsPersonalInfo reports whether the password contains one of the values,
+// ignoring case. Email addresses are checked by their local part.
+func containsPersonalInfo(password string, values []string) bool {
+	lower := strings.ToLower(password)
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if at := strings.Index(value, "@"); at >= 0 {
+			value = value[:at]
+		}
+		if len([]rune(value)) >= minPersonalInfoLength && strings.Contains(lower, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBreachedPassword reports whether the SHA-1 hash of the password is listed in
+// PASSWORD_BREACHED_LIST_FILE. The file is searched on disk for every check, so
+// lists of any size take no memory and a replaced file applies at once. Errors
+// are logged and let the password through.
+func IsBreachedPassword(password string) bool {
+	file := config.GetPasswordBreachedListFile()
+	if file == "" {
+		return false
+	}
+
+	sum := sha1.Sum([]byte(password))
+	found, err := searchBreachedList(file, strings.ToUpper(hex.EncodeToString(sum[:])))
+	if err != nil {
+		log.Printf("Failed to search breached password list: %v", err)
+		return false
+	}
+	return found
+}
+
+// searchBreachedList binary searches a file of hex encoded SHA-1 hashes, one per
+// line and sorted by hash, such as the "ordered by hash" download of Have I Been
+// Pwned. Lines may carry a ":count" suffix.
+func searchBreachedList(file, hash string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	size := info.Size()
+
+	// Find the lowest offset whose next line holds a hash at or after the wanted one
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, lineHash, err := breachedListLine(f, size, mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= size || lineHash >= hash {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	_, lineHash, err := breachedListLine(f, size, lo)
+	if err != nil {
+		return false, err
+	}
+	return lineHash == hash, nil
+}
+
+// breachedListLine returns the start and the upper case hash of the first line
+// of the breached password list that starts at or after offset. start is the
+// file size when there is no such line.
+func breachedListLine(f *os.File, size, offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// The line starts after the next newline, counting the byte before offset
+		start = offset - 1
+	}
+	reader := bufio.NewReader(io.NewSectionReader(f, start, size-start))
+	if offset > 0 {
+		skipped, err := reader.ReadBytes('\n')
+		start += int64(len(skipped))
+		if err == io.EOF {
+			return size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	return start, strings.ToUpper(strings.TrimSpace(line)), nil
+}
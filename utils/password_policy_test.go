@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"ambridge-backend/config"
+)
+
+// hasViolation reports whether the violations include the rule
+func hasViolation(violations []PasswordViolation, rule string) bool {
+	for _, violation := range violations {
+		if violation.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		rule     string
+	}{
+		{"too short", "Ab1", PasswordRuleMinLength},
+		{"no uppercase", "lowercase-only-1", PasswordRuleUpper},
+		{"no lowercase", "UPPERCASE-ONLY-1", PasswordRuleLower},
+		{"no digit", "No-Digits-Here", PasswordRuleDigit},
+		{"contains name", "Ambridge-Jane-2024", PasswordRulePersonalInfo},
+		{"contains email", "Xjane.doe-2024", PasswordRulePersonalInfo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := ValidatePassword(tt.password, "jane.doe@example.com", "Jane", "Doe")
+			if !hasViolation(violations, tt.rule) {
+				t.Fatalf("Expected %s violation for %q, got %v", tt.rule, tt.password, violations)
+			}
+		})
+	}
+
+	if violations := ValidatePassword("Correct-Horse-7", "jane.doe@example.com", "Jane", "Doe"); len(violations) != 0 {
+		t.Fatalf("Valid password rejected: %v", violations)
+	}
+}
+
+func TestValidatePasswordMaxLength(t *testing.T) {
+	long := "Aa1-" + strings.Repeat("x", 96)
+
+	withConfig(t, func(c *config.Config) {
+		c.PasswordHashAlgorithm = config.PasswordHashBcrypt
+		c.PasswordMaxLength = 128
+	})
+	if !hasViolation(ValidatePassword(long), PasswordRuleMaxLength) {
+		t.Fatalf("bcrypt accepted a password longer than %d bytes", bcryptMaxLength)
+	}
+
+	config.AppConfig.PasswordHashAlgorithm = config.PasswordHashArgon2id
+	if violations := ValidatePassword(long); hasViolation(violations, PasswordRuleMaxLength) {
+		t.Fatalf("argon2id is capped at the bcrypt limit: %v", violations)
+	}
+
+	config.AppConfig.PasswordMaxLength = 64
+	if !hasViolation(ValidatePassword(long), PasswordRuleMaxLength) {
+		t.Fatalf("PASSWORD_MAX_LENGTH is not applied with argon2id")
+	}
+}
+
+// writeBreachedList writes the SHA-1 hashes of the passwords in the sorted
+// layout of the Have I Been Pwned downloads and returns the file name
+func writeBreachedList(t *testing.T, passwords []string) string {
+	t.Helper()
+
+	lines := make([]string, 0, len(passwords))
+	for i, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, fmt.Sprintf("%s:%d\r\n", strings.ToUpper(hex.EncodeToString(sum[:])), i*37+1))
+	}
+	sort.Strings(lines)
+
+	file := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "")), 0o600); err != nil {
+		t.Fatalf("Failed to write breached list: %v", err)
+	}
+	return file
+}
+
+func TestIsBreachedPassword(t *testing.T) {
+	var breached []string
+	for i := 0; i < 500; i++ {
+		breached = append(breached, fmt.Sprintf("breached-%d", i))
+	}
+	file := writeBreachedList(t, breached)
+	withConfig(t, func(c *config.Config) { c.PasswordBreachedListFile = file })
+
+	// Every entry is found, including the first and last lines of the file
+	for _, password := range breached {
+		if !IsBreachedPassword(password) {
+			t.Fatalf("Listed password %q not found", password)
+		}
+	}
+	for i := 0; i < 500; i++ {
+		if password := fmt.Sprintf("safe-%d", i); IsBreachedPassword(password) {
+			t.Fatalf("Unlisted password %q reported as breached", password)
+		}
+	}
+	if !hasViolation(ValidatePassword("breached-42"), PasswordRuleBreached) {
+		t.Fatalf("Policy does not report breached passwords")
+	}
+}
+
+func TestIsBreachedPasswordEdgeCases(t *testing.T) {
+	dir := t.TempDir()
+
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	withConfig(t, func(c *config.Config) { c.PasswordBreachedListFile = empty })
+	if IsBreachedPassword("password") {
+		t.Fatalf("Empty list reported a breach")
+	}
+
+	// A single lower case line without a count or final newline
+	sum := sha1.Sum([]byte("password"))
+	single := filepath.Join(dir, "single.txt")
+	if err := os.WriteFile(single, []byte(hex.EncodeToString(sum[:])), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	config.AppConfig.PasswordBreachedListFile = single
+	if !IsBreachedPassword("password") || IsBreachedPassword("Password") {
+		t.Fatalf("Single line list not searched correctly")
+	}
+
+	// A missing file lets passwords through and is retried on the next check
+	missing := filepath.Join(dir, "missing.txt")
+	config.AppConfig.PasswordBreachedListFile = missing
+	if IsBreachedPassword("password") {
+		t.Fatalf("Missing list reported a breach")
+	}
+	if err := os.Rename(single, missing); err != nil {
+		t.Fatalf("Failed to move file: %v", err)
+	}
+	if !IsBreachedPassword("password") {
+		t.Fatalf("List created after a failed check is not used")
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+)
+
+// permissionCache keeps the permissions of each role in memory so that
+// permission checks do not hit MySQL on every request. Changes made on other
+// instances are picked up once the cached entry expires.
+var permissionCache = struct {
+	mu    sync.RWMutex
+	roles map[string]cacheEntry[map[string]bool]
+}{roles: make(map[string]cacheEntry[map[string]bool])}
+
+// RolePermissions returns the set of permissions granted to a role
+func RolePermissions(role string) (map[string]bool, error) {
+	permissionCache.mu.RLock()
+	entry, ok := permissionCache.roles[role]
+	permissionCache.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	var names []string
+	err := database.DB.Model(&models.Permission{}).
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id AND roles.deleted_at IS NULL").
+		Where("roles.name = ?", role).
+		Pluck("permissions.name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make(map[string]bool, len(names))
+	for _, name := range names {
+		permissions[name] = true
+	}
+
+	ttl := time.Duration(config.GetPermissionCacheTTL()) * time.Second
+	permissionCache.mu.Lock()
+	permissionCache.roles[role] = cacheEntry[map[string]bool]{value: permissions, expires: time.Now().Add(ttl)}
+	permissionCache.mu.Unlock()
+
+	return permissions, nil
+}
+
+// HasPermission reports whether a role grants the given permission
+func HasPermission(role, permission string) (bool, error) {
+	permissions, err := RolePermissions(role)
+	if err != nil {
+		return false, err
+	}
+	return permissions[permission], nil
+}
+
+// InvalidateRolePermissions drops the cached permissions of a role after they changed
+func InvalidateRolePermissions(role string) {
+	permissionCache.mu.Lock()
+	defer permissionCache.mu.Unlock()
+
+	delete(permissionCache.roles, role)
+}
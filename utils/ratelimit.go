@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter allows at most a fixed number of events per key within a sliding window
+type RateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	events    map[string][]time.Time
+	lastPrune time.Time
+}
+
+// NewRateLimiter creates an in-memory rate limiter
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:  limit,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for the key and reports whether it is within the limit
+func (r *RateLimiter) Allow(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	events := r.recent(key, now)
+	if len(events) >= r.limit {
+		r.events[key] = events
+		return false
+	}
+
+	r.events[key] = append(events, now)
+	r.prune(now)
+	return true
+}
+
+// recent returns the events for the key that are still inside the window
+func (r *RateLimiter) recent(key string, now time.Time) []time.Time {
+	events := r.events[key]
+	i := 0
+	for i < len(events) && now.Sub(events[i]) >= r.window {
+		i++
+	}
+	return events[i:]
+}
+
+// prune drops keys without recent events so the map does not grow forever
+func (r *RateLimiter) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < r.window {
+		return
+	}
+	r.lastPrune = now
+	for key := range r.events {
+		if len(r.recent(key, now)) == 0 {
+			delete(r.events, key)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ambridge-backend/config"
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+)
+
+// cacheEntry is a cached lookup result that is valid until expires
+type cacheEntry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// revocationCache keeps recent revocation lookups in memory so that
+// AuthMiddleware does not hit MySQL on every request. Revocations made on
+// other instances are picked up once the cached entry expires.
+type revocationCache struct {
+	mu       sync.RWMutex
+	tokens   map[string]cacheEntry[bool]
+	sessions map[uint]cacheEntry[bool]
+	users    map[uint]cacheEntry[time.Time]
+	statuses map[uint]cacheEntry[string]
+}
+
+var revocations = &revocationCache{
+	tokens:   make(map[string]cacheEntry[bool]),
+	sessions: make(map[uint]cacheEntry[bool]),
+	users:    make(map[uint]cacheEntry[time.Time]),
+	statuses: make(map[uint]cacheEntry[string]),
+}
+
+// cacheTTL returns how long a lookup result is trusted
+func cacheTTL() time.Duration {
+	return time.Duration(config.GetRevocationCacheTTL()) * time.Second
+}
+
+// lookup returns the cached value for key if it has not expired yet
+func lookup[K comparable, T any](c *revocationCache, m map[K]cacheEntry[T], key K) (T, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := m[key]
+	if !ok || time.Now().After(entry.expires) {
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// store caches a value for key until expires
+func store[K comparable, T any](c *revocationCache, m map[K]cacheEntry[T], key K, value T, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m[key] = cacheEntry[T]{value: value, expires: expires}
+}
+
+// RevokeToken adds an access token to the revocation list until it expires
+func RevokeToken(jti string, userID uint, expiresAt time.Time) error {
+	record := models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+		return err
+	}
+
+	store(revocations, revocations.tokens, jti, true, expiresAt)
+	return nil
+}
+
+// ConsumeToken marks a single-use token as used by adding it to the revocation
+// list. It reports false when the token was used before.
+func ConsumeToken(jti string, userID uint, expiresAt time.Time) (bool, error) {
+	record := models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	store(revocations, revocations.tokens, jti, true, expiresAt)
+	return true, nil
+}
+
+// IsTokenRevoked reports whether the access token with the given ID was revoked
+func IsTokenRevoked(jti string) (bool, error) {
+	if revoked, ok := lookup(revocations, revocations.tokens, jti); ok {
+		return revoked, nil
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	store(revocations, revocations.tokens, jti, count > 0, time.Now().Add(cacheTTL()))
+	return count > 0, nil
+}
+
+// MarkSessionRevoked updates the cache after a session was revoked so that
+// its access tokens are rejected immediately on this instance
+func MarkSessionRevoked(sessionID uint) {
+	store(revocations, revocations.sessions, sessionID, true, time.Now().Add(cacheTTL()))
+}
+
+// IsSessionRevoked reports whether the session an access token belongs to was revoked
+func IsSessionRevoked(sessionID uint) (bool, error) {
+	if revoked, ok := lookup(revocations, revocations.sessions, sessionID); ok {
+		return revoked, nil
+	}
+
+	var session models.Session
+	revoked := false
+	result := database.DB.Select("id", "revoked_at").First(&session, sessionID)
+	if result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return false, result.Error
+		}
+		revoked = true
+	} else {
+		revoked = session.RevokedAt != nil
+	}
+
+	store(revocations, revocations.sessions, sessionID, revoked, time.Now().Add(cacheTTL()))
+	return revoked, nil
+}
+
+// RevokeUserTokens invalidates every access token issued to the user so far,
+// e.g. after a password reset or a role change. Tokens issued up to the cutoff
+// are rejected, so it only returns once tokens issued afterwards are certain
+// to carry a later issue time.
+func RevokeUserTokens(userID uint) error {
+	// Issue times and the stored cutoff have a resolution of one millisecond, and
+	// an issue time read back from its JSON number may come out one millisecond
+	// early. The cutoff is rounded up past now and the next tokens wait two more.
+	cutoff := time.Now().Truncate(time.Millisecond).Add(time.Millisecond)
+	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).Update("tokens_valid_after", cutoff).Error; err != nil {
+		return err
+	}
+
+	store(revocations, revocations.users, userID, cutoff, time.Now().Add(cacheTTL()))
+	time.Sleep(time.Until(cutoff.Add(2 * time.Millisecond)))
+	return nil
+}
+
+// IssuedBeforeCutoff reports whether a token was issued at or before the
+// user's cutoff set by RevokeUserTokens
+func IssuedBeforeCutoff(claims *Claims, cutoff time.Time) bool {
+	return !claims.IssuedAt.Time.After(cutoff)
+}
+
+// TokensValidAfter returns the time up to which access tokens of the user are
+// rejected, or the zero time when the user never revoked their tokens
+func TokensValidAfter(userID uint) (time.Time, error) {
+	if cutoff, ok := lookup(revocations, revocations.users, userID); ok {
+		return cutoff, nil
+	}
+
+	var user models.User
+	var cutoff time.Time
+	result := database.DB.Select("id", "tokens_valid_after").First(&user, userID)
+	if result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return time.Time{}, result.Error
+		}
+		// Tokens of deleted users are never valid again
+		cutoff = time.Now().Add(time.Hour * 24 * 365)
+	} else if user.TokensValidAfter != nil {
+		cutoff = *user.TokensValidAfter
+	}
+
+	store(revocations, revocations.users, userID, cutoff, time.Now().Add(cacheTTL()))
+	return cutoff, nil
+}
+
+// StartRevocationPruner periodically removes expired revocations from the
+// database and expired entries from the in-memory cache
+func StartRevocationPruner(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			pruneRevocations()
+		}
+	}()
+}
+
+// pruneRevocations removes revocation rows of tokens that have expired anyway
+func pruneRevocations() {
+	now := time.Now()
+	if err := database.DB.Unscoped().Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		log.Printf("Failed to prune revoked tokens: %v", err)
+	}
+
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+
+	for key, entry := range revocations.tokens {
+		if now.After(entry.expires) {
+			delete(revocations.tokens, key)
+		}
+	}
+	for key, entry := range revocations.sessions {
+		if now.After(entry.expires) {
+			delete(revocations.sessions, key)
+		}
+	}
+	for key, entry := range revocations.users {
+		if now.After(entry.expires) {
+			delete(revocations.users, key)
+		}
+	}
+	for key, entry := range revocations.statuses {
+		if now.After(entry.expires) {
+			delete(revocations.statuses, key)
+		}
+	}
+}
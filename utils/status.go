@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ambridge-backend/database"
+	"ambridge-backend/models"
+)
+
+// UserStatus returns the account status of a user. Users that no longer exist
+// are reported as deleted.
+func UserStatus(userID uint) (string, error) {
+	if status, ok := lookup(revocations, revocations.statuses, userID); ok {
+		return status, nil
+	}
+
+	var user models.User
+	status := models.UserStatusDeleted
+	result := database.DB.Select("id", "status").First(&user, userID)
+	if result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return "", result.Error
+		}
+	} else {
+		status = user.Status
+	}
+
+	store(revocations, revocations.statuses, userID, status, time.Now().Add(cacheTTL()))
+	return status, nil
+}
+
+// MarkUserStatus updates the cache after a user's status changed so that it
+// is enforced immediately on this instance
+func MarkUserStatus(userID uint, status string) {
+	store(revocations, revocations.statuses, userID, status, time.Now().Add(cacheTTL()))
+}